@@ -15,6 +15,7 @@
 package apigee
 
 import (
+	"context"
 	"net/url"
 	"path"
 )
@@ -25,7 +26,11 @@ const cachePath = "caches"
 // dealing with caches.
 type CacheService interface {
 	Get(cachename string) (*Cache, *Response, error)
+	GetWithContext(ctx context.Context, cachename string) (*Cache, *Response, error)
 	Create(cache Cache) (*Response, error)
+	CreateWithContext(ctx context.Context, cache Cache) (*Response, error)
+	Delete(cachename string) (*Response, error)
+	DeleteWithContext(ctx context.Context, cachename string) (*Response, error)
 }
 
 // Cache represents a cache definition
@@ -55,8 +60,13 @@ var _ CacheService = &CacheServiceOp{}
 
 // Get returns a response given a cache name
 func (s *CacheServiceOp) Get(cachename string) (*Cache, *Response, error) {
+	return s.GetWithContext(context.Background(), cachename)
+}
+
+// GetWithContext is Get with a Context for the request
+func (s *CacheServiceOp) GetWithContext(ctx context.Context, cachename string) (*Cache, *Response, error) {
 	path := path.Join(cachePath, cachename)
-	req, e := s.client.NewRequest("GET", path, nil)
+	req, e := s.client.NewRequestWithContext(ctx, "GET", path, nil)
 	if e != nil {
 		return nil, nil, e
 	}
@@ -70,15 +80,35 @@ func (s *CacheServiceOp) Get(cachename string) (*Cache, *Response, error) {
 
 // Create creates a cache and returns a response
 func (s *CacheServiceOp) Create(cache Cache) (*Response, error) {
+	return s.CreateWithContext(context.Background(), cache)
+}
+
+// CreateWithContext is Create with a Context for the request
+func (s *CacheServiceOp) CreateWithContext(ctx context.Context, cache Cache) (*Response, error) {
 	path := path.Join(cachePath)
 	u, _ := url.Parse(path)
 	q := u.Query()
 	q.Set("name", cache.Name)
 	u.RawQuery = q.Encode()
-	req, e := s.client.NewRequest("POST", u.String(), cache)
+	req, e := s.client.NewRequestWithContext(ctx, "POST", u.String(), cache)
 	if e != nil {
 		return nil, e
 	}
 	resp, e := s.client.Do(req, &cache)
 	return resp, e
 }
+
+// Delete deletes a cache
+func (s *CacheServiceOp) Delete(cachename string) (*Response, error) {
+	return s.DeleteWithContext(context.Background(), cachename)
+}
+
+// DeleteWithContext is Delete with a Context for the request
+func (s *CacheServiceOp) DeleteWithContext(ctx context.Context, cachename string) (*Response, error) {
+	path := path.Join(cachePath, cachename)
+	req, e := s.client.NewRequestWithContext(ctx, "DELETE", path, nil)
+	if e != nil {
+		return nil, e
+	}
+	return s.client.Do(req, nil)
+}
@@ -0,0 +1,200 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credential provider names for EdgeAuth.Method
+const (
+	AuthFlags          = "flags"
+	AuthEnv            = "env"
+	AuthNetrc          = "netrc"
+	AuthCommand        = "command"
+	AuthFile           = "file"
+	AuthServiceAccount = "service-account"
+	AuthADC            = "adc"
+	AuthLogin          = "login"
+)
+
+// Environment variables read by the env credential provider
+const (
+	TokenEnv    = "APIGEE_TOKEN"
+	UsernameEnv = "APIGEE_USERNAME"
+	PasswordEnv = "APIGEE_PASSWORD"
+)
+
+// DefaultCommandTokenTTL is how long a token printed by an auth command is reused
+const DefaultCommandTokenTTL = 5 * time.Minute
+
+// CredentialProvider applies credentials for the Edge Management server to requests
+type CredentialProvider interface {
+	ApplyTo(req *http.Request) error
+}
+
+// AuthMethods returns the names of the available credential providers
+func AuthMethods() []string {
+	return []string{AuthFlags, AuthEnv, AuthNetrc, AuthCommand, AuthFile, AuthServiceAccount, AuthADC, AuthLogin}
+}
+
+// provider returns the CredentialProvider selected by Method. If Method is
+// empty, the provider is inferred from the fields that are set.
+func (auth *EdgeAuth) provider(host string, client *http.Client) (CredentialProvider, error) {
+	switch auth.Method {
+	case "":
+		switch {
+		case auth.Provider != nil:
+			return auth.Provider, nil
+		case auth.GoogleCredentialsPath != "" || auth.UseADC:
+			return newGoogleTokenSourceFor(auth.GoogleCredentialsPath, client)
+		case auth.Command != "":
+			return newCommandCredentials(auth.Command), nil
+		case auth.File != "":
+			return &fileCredentials{path: auth.File}, nil
+		case auth.Password != "" || auth.BearerToken != "":
+			return staticCredentials(auth), nil
+		case host == legacySaaSHost && hasCachedLogin(auth.TokenCachePath):
+			return newLoginCredentials(auth.TokenCachePath, client)
+		default:
+			return retrieveAuthFromNetrc(auth.NetrcPath, host)
+		}
+	case AuthFlags:
+		if auth.Password == "" && auth.BearerToken == "" {
+			return nil, errors.New("flags credentials require a token or a username and password")
+		}
+		return staticCredentials(auth), nil
+	case AuthEnv:
+		return envCredentials()
+	case AuthNetrc:
+		return retrieveAuthFromNetrc(auth.NetrcPath, host)
+	case AuthCommand:
+		if auth.Command == "" {
+			return nil, errors.New("command credentials require an auth command")
+		}
+		return newCommandCredentials(auth.Command), nil
+	case AuthFile:
+		if auth.File == "" {
+			return nil, errors.New("file credentials require an auth file")
+		}
+		return &fileCredentials{path: auth.File}, nil
+	case AuthServiceAccount:
+		if auth.GoogleCredentialsPath == "" {
+			return nil, errors.New("service-account credentials require a service account key file")
+		}
+		return newGoogleTokenSourceFor(auth.GoogleCredentialsPath, client)
+	case AuthADC:
+		return newGoogleTokenSourceFor("", client)
+	case AuthLogin:
+		return newLoginCredentials(auth.TokenCachePath, client)
+	default:
+		return nil, fmt.Errorf("unknown auth method %q, must be one of: %s",
+			auth.Method, strings.Join(AuthMethods(), ", "))
+	}
+}
+
+// staticCredentials returns an EdgeAuth with only the token or basic credentials of auth
+func staticCredentials(auth *EdgeAuth) *EdgeAuth {
+	return &EdgeAuth{
+		Username:    auth.Username,
+		Password:    auth.Password,
+		BearerToken: auth.BearerToken,
+	}
+}
+
+// envCredentials reads a token or username and password from the environment
+func envCredentials() (*EdgeAuth, error) {
+	auth := &EdgeAuth{
+		BearerToken: os.Getenv(TokenEnv),
+		Username:    os.Getenv(UsernameEnv),
+		Password:    os.Getenv(PasswordEnv),
+	}
+	if auth.BearerToken == "" && (auth.Username == "" || auth.Password == "") {
+		return nil, fmt.Errorf("env credentials require %s or %s and %s", TokenEnv, UsernameEnv, PasswordEnv)
+	}
+	return auth, nil
+}
+
+// commandCredentials runs a command that prints a bearer token, reusing the
+// token until its TTL expires
+type commandCredentials struct {
+	command string
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newCommandCredentials(command string) *commandCredentials {
+	return &commandCredentials{command: command, ttl: DefaultCommandTokenTTL}
+}
+
+func (c *commandCredentials) ApplyTo(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == "" || time.Now().After(c.expires) {
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(req.Context(), shell, flag, c.command)
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("running auth command: %v", err)
+		}
+		token := strings.TrimSpace(stdout.String())
+		if token == "" {
+			return errors.New("auth command printed no token")
+		}
+		c.token = token
+		c.expires = time.Now().Add(c.ttl)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return nil
+}
+
+// fileCredentials reads a bearer token from a file on every request so that
+// the token may be refreshed by another process
+type fileCredentials struct {
+	path string
+}
+
+func (f *fileCredentials) ApplyTo(req *http.Request) error {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("reading auth file: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("auth file %s is empty", f.path)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCredentialProviders(t *testing.T) {
+	var auths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+
+	tokenFile, err := ioutil.TempFile("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tokenFile.Name())
+	tokenFile.WriteString("/file-token/\n")
+	tokenFile.Close()
+
+	defer os.Setenv(TokenEnv, os.Getenv(TokenEnv))
+	os.Setenv(TokenEnv, "/env-token/")
+
+	tests := []struct {
+		auth EdgeAuth
+		want string
+	}{
+		{EdgeAuth{Username: "/username/", Password: "password"}, "Basic L3VzZXJuYW1lLzpwYXNzd29yZA=="},
+		{EdgeAuth{BearerToken: "/token/"}, "Bearer /token/"},
+		{EdgeAuth{Method: AuthEnv}, "Bearer /env-token/"},
+		{EdgeAuth{File: tokenFile.Name()}, "Bearer /file-token/"},
+		{EdgeAuth{Method: AuthCommand, Command: "echo /command-token/"}, "Bearer /command-token/"},
+	}
+	for _, test := range tests {
+		auths = nil
+		auth := test.auth
+		client := newTestClient(t, ts.URL, EdgeClientOptions{Auth: &auth})
+		req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Do(req, nil); err != nil {
+			t.Errorf("%+v want no error, got: %v", test.auth, err)
+		}
+		if len(auths) != 1 || auths[0] != test.want {
+			t.Errorf("%+v want auth %s, got: %v", test.auth, test.want, auths)
+		}
+	}
+}
+
+func TestCredentialsAppliedPerAttempt(t *testing.T) {
+	tokenFile, err := ioutil.TempFile("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tokenFile.Name())
+	tokenFile.WriteString("/expired/\n")
+	tokenFile.Close()
+
+	// the token is refreshed while the first attempt fails
+	var auths []string
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		if requests++; requests == 1 {
+			ioutil.WriteFile(tokenFile.Name(), []byte("/refreshed/\n"), 0600)
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{
+		Auth:  &EdgeAuth{File: tokenFile.Name()},
+		Retry: RetryPolicy{MaxRetries: 1},
+	})
+	req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req, nil); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	want := []string{"Bearer /expired/", "Bearer /refreshed/"}
+	if !reflect.DeepEqual(want, auths) {
+		t.Errorf("want auths %v, got: %v", want, auths)
+	}
+
+	// a request with its own credentials is sent as is
+	auths = nil
+	req, err = http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("/key/", "secret")
+	if _, err := client.Do(req, nil); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	if len(auths) != 1 || auths[0] != "Basic L2tleS86c2VjcmV0" {
+		t.Errorf("want own credentials, got: %v", auths)
+	}
+}
+
+func TestCredentialProvidersInvalid(t *testing.T) {
+	defer os.Setenv(TokenEnv, os.Getenv(TokenEnv))
+	os.Unsetenv(TokenEnv)
+
+	tests := []struct {
+		auth EdgeAuth
+		want string
+	}{
+		{EdgeAuth{Method: "/bad/"}, `unknown auth method "/bad/"`},
+		{EdgeAuth{Method: AuthFlags}, "require a token or a username and password"},
+		{EdgeAuth{Method: AuthEnv}, "env credentials require " + TokenEnv},
+		{EdgeAuth{Method: AuthCommand}, "require an auth command"},
+		{EdgeAuth{Method: AuthFile}, "require an auth file"},
+	}
+	for _, test := range tests {
+		auth := test.auth
+		if _, err := NewEdgeClient(&EdgeClientOptions{MgmtURL: "http://localhost", Auth: &auth}); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%+v want error %q, got: %v", test.auth, test.want, err)
+		}
+	}
+}
@@ -17,19 +17,20 @@ package apigee
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"path"
 	"reflect"
+	"time"
 
 	"github.com/bgentry/go-netrc/netrc"
 	"github.com/google/go-querystring/query"
@@ -38,6 +39,7 @@ import (
 const (
 	libraryVersion = "0.1.0"
 	defaultBaseURL = "https://api.enterprise.apigee.com/"
+	legacySaaSHost = "api.enterprise.apigee.com"
 	userAgent      = "go-apigee-edge/" + libraryVersion
 	appJSON        = "application/json"
 	octetStream    = "application/octet-stream"
@@ -48,8 +50,12 @@ type EdgeClient struct {
 	// HTTP client used to communicate with the Edge API.
 	client *http.Client
 
-	auth  *EdgeAuth
-	debug bool
+	auth        *EdgeAuth
+	debug       bool
+	unsafeDebug bool
+	retry       RetryPolicy
+	timeout     time.Duration
+	tracer      *Tracer
 
 	// Base URL for API requests.
 	BaseURL *url.URL
@@ -66,6 +72,8 @@ type EdgeClient struct {
 	KVMService KVMService
 
 	CacheService CacheService
+
+	Products ProductsService
 	// Account           AccountService
 	// Actions           ActionsService
 	// Domains           DomainsService
@@ -101,19 +109,19 @@ type Response struct {
 	*http.Response
 }
 
-// An ErrorResponse reports the error caused by an API request
+// An ErrorResponse reports the error caused by an API request. Use errors.Is
+// with ErrNotFound, ErrConflict, ErrUnauthorized, ErrForbidden or
+// ErrRateLimited to check for common failures.
 type ErrorResponse struct {
 	// HTTP response that caused this error
 	Response *http.Response
 
-	// Error message - maybe the json for this is "fault"
-	// Message string `json:"message"`
-
-	// Error message - maybe the json for this is "fault"
+	// Error message parsed from either the GCP or Edge error format
 	Message ResponseErrorMessage `json:"error"`
 }
 
-// ResponseErrorMessage is a component of an ErrorResponse
+// ResponseErrorMessage is a component of an ErrorResponse. For Edge errors,
+// Status holds the fault code, eg. "messaging.adaptors.http.flow.ApplicationNotFound".
 type ResponseErrorMessage struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -163,14 +171,29 @@ type EdgeClientOptions struct {
 	// Required. Authentication information for the Edge Management server.
 	Auth *EdgeAuth
 
-	// Optional. Warning: if set to true, HTTP Basic Auth base64 blobs will appear in output.
+	// Optional. If true, HTTP requests and responses are dumped to output with
+	// credentials and secrets redacted.
 	Debug bool
 
+	// Optional. Warning: if set to true, Debug output is not redacted and
+	// credentials and secrets will appear in output.
+	UnsafeDebug bool
+
 	// Optional. For hybrid and NG must be true.
 	GCPManaged bool
 
 	// Optional. Skip cert verification.
 	InsecureSkipVerify bool
+
+	// Optional. Time limit for each attempt of a request. Zero means no
+	// timeout. Proxy bundle imports and deployments aren't limited.
+	Timeout time.Duration
+
+	// Optional. Retry policy for transient failures. Zero means no retries.
+	Retry RetryPolicy
+
+	// Optional. Records requests and responses for export as a HAR file.
+	Tracer *Tracer
 }
 
 // EdgeAuth holds information about how to authenticate to the Edge Management server.
@@ -191,15 +214,46 @@ type EdgeAuth struct {
 
 	// BearerToken token for OAuth or SAML
 	BearerToken string
+
+	// Optional. Path to a Google service account key or authorized user
+	// credentials file used to obtain OAuth tokens (GCP only).
+	GoogleCredentialsPath string
+
+	// Optional. Use Google Application Default Credentials to obtain OAuth
+	// tokens (GCP only). Ignored if GoogleCredentialsPath is set.
+	UseADC bool
+
+	// Optional. Command that prints a bearer token.
+	Command string
+
+	// Optional. File containing a bearer token, read for each request.
+	File string
+
+	// Optional. File in which login tokens are cached. Defaults to
+	// DefaultTokenCachePath().
+	TokenCachePath string
+
+	// Optional. Name of the credential provider to use, one of AuthMethods().
+	// If empty, the provider is inferred from the other fields.
+	Method string
+
+	// Optional. Applies credentials instead of the other fields.
+	Provider CredentialProvider
 }
 
+var _ CredentialProvider = &EdgeAuth{}
+
 // ApplyTo applies the auth info onto a request
-func (auth *EdgeAuth) ApplyTo(req *http.Request) {
+func (auth *EdgeAuth) ApplyTo(req *http.Request) error {
+	if auth.Provider != nil {
+		return auth.Provider.ApplyTo(req)
+	}
 	if auth.BearerToken != "" {
 		req.Header.Add("Authorization", "Bearer "+auth.BearerToken)
 	} else {
 		req.SetBasicAuth(auth.Username, auth.Password)
 	}
+	return nil
 }
 
 func retrieveAuthFromNetrc(netrcPath, host string) (*EdgeAuth, error) {
@@ -208,7 +262,7 @@ func retrieveAuthFromNetrc(netrcPath, host string) (*EdgeAuth, error) {
 	}
 	n, e := netrc.ParseFile(netrcPath)
 	if e != nil {
-		fmt.Printf("while parsing .netrc, error:\n%#v\n", e)
+		fmt.Fprintf(os.Stderr, "while parsing .netrc, error:\n%#v\n", e)
 		return nil, e
 	}
 	machine := n.FindMachine(host) // eg, "api.enterprise.apigee.com"
@@ -222,12 +276,12 @@ func retrieveAuthFromNetrc(netrcPath, host string) (*EdgeAuth, error) {
 
 // NewEdgeClient returns a new EdgeClient.
 func NewEdgeClient(o *EdgeClientOptions) (*EdgeClient, error) {
-	httpClient := http.DefaultClient
+	httpClient := &http.Client{}
 
 	if o.InsecureSkipVerify {
 		tr := http.DefaultTransport.(*http.Transport).Clone()
 		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		httpClient = &http.Client{Transport: tr}
+		httpClient.Transport = tr
 	}
 
 	mgmtURL := o.MgmtURL
@@ -252,32 +306,32 @@ func NewEdgeClient(o *EdgeClientOptions) (*EdgeClient, error) {
 		BaseURLEnv:   baseURLEnv,
 		UserAgent:    userAgent,
 		IsGCPManaged: o.GCPManaged,
+		retry:        o.Retry,
+		timeout:      o.Timeout,
+		tracer:       o.Tracer,
 	}
 	c.Proxies = &ProxiesServiceOp{client: c}
 	c.KVMService = &KVMServiceOp{client: c}
 	c.CacheService = &CacheServiceOp{client: c}
+	c.Products = &ProductsServiceOp{client: c}
 
 	if !o.Auth.SkipAuth {
-		var e error
-		if o.Auth == nil || (o.Auth.Password == "" && o.Auth.BearerToken == "") {
-			c.auth, e = retrieveAuthFromNetrc(o.Auth.NetrcPath, baseURL.Host)
-		} else {
-			c.auth = &EdgeAuth{
-				Username:    o.Auth.Username,
-				Password:    o.Auth.Password,
-				BearerToken: o.Auth.BearerToken,
-			}
-		}
+		// token requests are limited by the timeout as a whole
+		authClient := &http.Client{Transport: httpClient.Transport, Timeout: o.Timeout}
+		provider, e := o.Auth.provider(baseURL.Host, authClient)
 		if e != nil {
 			return nil, e
 		}
+		c.auth = &EdgeAuth{Provider: provider}
 	}
 
 	if o.Debug {
 		c.debug = true
-		c.onRequestCompleted = func(req *http.Request, resp *http.Response) {
-			debugDump(httputil.DumpResponse(resp, true))
-		}
+		c.unsafeDebug = o.UnsafeDebug
+	}
+
+	if o.Tracer != nil {
+		c.onRequestCompleted = o.Tracer.record
 	}
 
 	return c, nil
@@ -289,15 +343,25 @@ func NewEdgeClient(o *EdgeClientOptions) (*EdgeClient, error) {
 // pointed to by body is JSON encoded and included in as the request body.
 // The current environment path element will be included in the URL.
 func (c *EdgeClient) NewRequest(method, urlStr string, body interface{}) (*http.Request, error) {
-	return c.newRequest(method, urlStr, body, true)
+	return c.newRequest(context.Background(), method, urlStr, body, true)
+}
+
+// NewRequestWithContext creates an API request as NewRequest, using ctx for the request.
+func (c *EdgeClient) NewRequestWithContext(ctx context.Context, method, urlStr string, body interface{}) (*http.Request, error) {
+	return c.newRequest(ctx, method, urlStr, body, true)
 }
 
 // NewRequestNoEnv creates an API request as NewRequest, but does not include the environment path element.
 func (c *EdgeClient) NewRequestNoEnv(method, urlStr string, body interface{}) (*http.Request, error) {
-	return c.newRequest(method, urlStr, body, false)
+	return c.newRequest(context.Background(), method, urlStr, body, false)
+}
+
+// NewRequestNoEnvWithContext creates an API request as NewRequestNoEnv, using ctx for the request.
+func (c *EdgeClient) NewRequestNoEnvWithContext(ctx context.Context, method, urlStr string, body interface{}) (*http.Request, error) {
+	return c.newRequest(ctx, method, urlStr, body, false)
 }
 
-func (c *EdgeClient) newRequest(method, urlStr string, body interface{}, includeEnv bool) (*http.Request, error) {
+func (c *EdgeClient) newRequest(ctx context.Context, method, urlStr string, body interface{}, includeEnv bool) (*http.Request, error) {
 	rel, err := url.Parse(urlStr)
 	ctype := ""
 	if err != nil {
@@ -321,13 +385,13 @@ func (c *EdgeClient) newRequest(method, urlStr string, body interface{}, include
 			if err != nil {
 				return nil, err
 			}
-			req, err = http.NewRequest(method, u.String(), buf)
+			req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 		case io.Reader:
 			ctype = octetStream
-			req, err = http.NewRequest(method, u.String(), body.(io.Reader))
+			req, err = http.NewRequestWithContext(ctx, method, u.String(), body.(io.Reader))
 		}
 	} else {
-		req, err = http.NewRequest(method, u.String(), nil)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), nil)
 	}
 
 	if err != nil {
@@ -340,7 +404,8 @@ func (c *EdgeClient) newRequest(method, urlStr string, body interface{}, include
 	req.Header.Add("Accept", appJSON)
 	req.Header.Add("User-Agent", c.UserAgent)
 	if c.auth != nil {
-		c.auth.ApplyTo(req)
+		// the credentials are applied when the request is sent
+		req = req.WithContext(context.WithValue(req.Context(), authorizeKey{}, true))
 	}
 	return req, nil
 }
@@ -357,12 +422,17 @@ func newResponse(r *http.Response) *Response {
 	return &response
 }
 
-func debugDump(data []byte, err error) {
-	if err == nil {
-		fmt.Printf("%s\n\n", data)
-	} else {
-		log.Fatalf("%s\n\n", err)
+// debugDump prints a dumped request or response to stderr, so that it isn't
+// mixed with a command's output, or returns the error of dumping it
+func (c *EdgeClient) debugDump(data []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	if !c.unsafeDebug {
+		data = redact(data)
 	}
+	fmt.Fprintf(os.Stderr, "%s\n\n", data)
+	return nil
 }
 
 // Do sends an API request and returns the API response. The API response is
@@ -370,17 +440,13 @@ func debugDump(data []byte, err error) {
 // if an API error has occurred. If v implements the io.Writer interface, the
 // raw response will be written to v, without attempting to decode it.
 func (c *EdgeClient) Do(req *http.Request, v interface{}) (*Response, error) {
-	if c.debug {
-		debugDump(httputil.DumpRequestOut(req, true))
-	}
-
-	resp, err := c.client.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, err
 	}
-	if c.onRequestCompleted != nil {
-		c.onRequestCompleted(req, resp)
-	}
 
 	defer func() {
 		if rerr := resp.Body.Close(); err == nil {
@@ -412,16 +478,142 @@ func (c *EdgeClient) Do(req *http.Request, v interface{}) (*Response, error) {
 	return response, err
 }
 
+// send sends the request, retrying transient failures according to the retry policy
+func (c *EdgeClient) send(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if c.tracer != nil {
+			req = withStartTime(req)
+		}
+		attemptReq, cancel := c.withTimeout(req)
+		attemptReq, err := c.authorize(attemptReq)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if c.debug {
+			if err := c.debugDump(httputil.DumpRequestOut(attemptReq, true)); err != nil {
+				cancel()
+				return nil, err
+			}
+		}
+		resp, err := c.client.Do(attemptReq)
+		if err == nil && c.debug {
+			if err := c.debugDump(httputil.DumpResponse(resp, true)); err != nil {
+				resp.Body.Close()
+				cancel()
+				return nil, err
+			}
+		}
+		if err == nil && c.onRequestCompleted != nil {
+			c.onRequestCompleted(attemptReq, resp)
+		}
+		if err == nil {
+			resp.Body = cancelOnClose{resp.Body, cancel}
+		} else {
+			cancel()
+		}
+		if err != nil && c.tracer != nil {
+			c.tracer.recordError(attemptReq, err)
+		}
+		if attempt >= c.retry.MaxRetries || !c.retry.canRetry(req) || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay := c.retry.backoff(attempt, resp)
+		if c.debug {
+			reason := ""
+			if err != nil {
+				reason = err.Error()
+			} else {
+				reason = resp.Status
+			}
+			fmt.Fprintf(os.Stderr, "retrying %s %s in %v (%d of %d): %s\n\n",
+				req.Method, req.URL, delay.Round(time.Millisecond), attempt+1, c.retry.MaxRetries, reason)
+		}
+		discard(resp)
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+		if err := rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type authorizeKey struct{}
+
+// authorize returns a copy of req with the credentials of the client, if
+// it was created by the client. They're applied for each attempt, so that
+// a retry uses a token that was refreshed since the previous one.
+func (c *EdgeClient) authorize(req *http.Request) (*http.Request, error) {
+	if authorize, _ := req.Context().Value(authorizeKey{}).(bool); !authorize {
+		return req, nil // such as runtime requests with their own credentials
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del("Authorization")
+	if err := c.auth.ApplyTo(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+type noTimeoutKey struct{}
+
+// withoutTimeout returns a copy of req that isn't limited by the client
+// timeout. Use this for requests, such as proxy bundle imports, that may
+// take much longer than others.
+func withoutTimeout(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), noTimeoutKey{}, true))
+}
+
+// withTimeout returns a copy of req limited by the client timeout, and the
+// function that releases it
+func (c *EdgeClient) withTimeout(req *http.Request) (*http.Request, context.CancelFunc) {
+	noTimeout, _ := req.Context().Value(noTimeoutKey{}).(bool)
+	if c.timeout <= 0 || noTimeout {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), c.timeout)
+	return req.WithContext(ctx), cancel
+}
+
+// cancelOnClose releases the timeout of a request when its response body,
+// which is read after the request is sent, is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// DoWithContext sends an API request as Do, using ctx for the request.
+func (c *EdgeClient) DoWithContext(ctx context.Context, req *http.Request, v interface{}) (*Response, error) {
+	if authorize, _ := req.Context().Value(authorizeKey{}).(bool); authorize {
+		ctx = context.WithValue(ctx, authorizeKey{}, true)
+	}
+	return c.Do(req.WithContext(ctx), v)
+}
+
 func (r *ErrorResponse) Error() string {
+	msg := r.Message.Message
+	if msg == "" {
+		msg = http.StatusText(r.Response.StatusCode)
+	}
+	if r.Message.Status != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, r.Message.Status)
+	}
 	return fmt.Sprintf("%v %v: %d %v",
-		r.Response.Request.Method, r.Response.Request.URL, r.Response.StatusCode, r.Message)
+		r.Response.Request.Method, r.Response.Request.URL, r.Response.StatusCode, msg)
 }
 
 // CheckResponse checks the API response for errors, and returns them if
 // present. A response is considered an error if it has a status code outside
 // the 200 range. API error responses are expected to have either no response
-// body, or a JSON response body that maps to ErrorResponse. Any other response
-// body will be silently ignored.
+// body, or a JSON response body in the GCP or Edge error format. Any other
+// response body is used as the message.
 func CheckResponse(r *http.Response) error {
 	if c := r.StatusCode; c >= 200 && c <= 299 {
 		return nil
@@ -430,12 +622,7 @@ func CheckResponse(r *http.Response) error {
 	errorResponse := &ErrorResponse{Response: r}
 	data, err := ioutil.ReadAll(r.Body)
 	if err == nil && len(data) > 0 {
-		err := json.Unmarshal(data, errorResponse)
-		if err != nil {
-			errorResponse.Message = ResponseErrorMessage{
-				Message: string(data),
-			}
-		}
+		errorResponse.Message = parseErrorMessage(data)
 	}
 
 	return errorResponse
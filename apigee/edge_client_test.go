@@ -0,0 +1,232 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client of org and env on baseURL that uses basic
+// auth unless opts sets Auth
+func newTestClient(t *testing.T, baseURL string, opts EdgeClientOptions) *EdgeClient {
+	opts.MgmtURL = baseURL
+	opts.Org = "org"
+	opts.Env = "env"
+	if opts.Auth == nil {
+		opts.Auth = &EdgeAuth{Username: "/username/", Password: "password"}
+	}
+	client, err := NewEdgeClient(&opts)
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	return client
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Timeout: 50 * time.Millisecond})
+	req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Do(req, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want timeout error, got: %v", err)
+	}
+}
+
+func TestClientTimeoutPerAttempt(t *testing.T) {
+	done := make(chan struct{})
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "product"}`))
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	// the retry has its own time limit, which also covers reading the response
+	client := newTestClient(t, ts.URL, EdgeClientOptions{
+		Timeout: 100 * time.Millisecond,
+		Retry:   RetryPolicy{MaxRetries: 1, MinBackoff: time.Millisecond},
+	})
+	req, err := client.NewRequest(http.MethodGet, "apiproducts/product", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var product Product
+	if _, err = client.Do(req, &product); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	if requests != 2 || product.Name != "product" {
+		t.Errorf("want product after 2 requests, got %v after %d", product, requests)
+	}
+}
+
+func TestClientTimeoutExempt(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Timeout: 20 * time.Millisecond})
+	if _, _, err := client.Proxies.Deploy("proxy", "env", 1); err != nil {
+		t.Errorf("want deploy without timeout, got: %v", err)
+	}
+	req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Do(withoutTimeout(req), nil); err != nil {
+		t.Errorf("want request without timeout, got: %v", err)
+	}
+}
+
+func TestClientCancelled(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Retry: RetryPolicy{MaxRetries: 3}})
+	req, err := client.NewRequestWithContext(ctx, http.MethodGet, "apiproducts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Do(req, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("want %v, got: %v", context.Canceled, err)
+	}
+	if requests != 0 {
+		t.Errorf("want no requests, got: %d", requests)
+	}
+}
+
+// errReader is a request body that can't be read
+type errReader struct{ err error }
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestClientDebugDumpError(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	// the error of dumping the request is returned rather than exiting
+	readErr := errors.New("unreadable")
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Debug: true})
+	req, err := client.NewRequest(http.MethodPost, "apiproducts", errReader{readErr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Do(req, nil); !errors.Is(err, readErr) {
+		t.Errorf("want %v, got: %v", readErr, err)
+	}
+	if requests != 0 {
+		t.Errorf("want no requests, got: %d", requests)
+	}
+}
+
+func TestClientDebugOutput(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	// capture stdout and stderr
+	capture := func(f **os.File) func() string {
+		orig := *f
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		*f = w
+		out := make(chan string)
+		go func() {
+			data, _ := ioutil.ReadAll(r)
+			out <- string(data)
+		}()
+		return func() string {
+			w.Close()
+			*f = orig
+			return <-out
+		}
+	}
+	stdout := capture(&os.Stdout)
+	stderr := capture(&os.Stderr)
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{
+		Debug: true,
+		Retry: RetryPolicy{MaxRetries: 1, MinBackoff: time.Millisecond},
+	})
+	req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Do(req, nil)
+	out, errOut := stdout(), stderr()
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	// the dumps and retries are kept off stdout
+	if out != "" {
+		t.Errorf("want no stdout, got:\n%s", out)
+	}
+	for _, want := range []string{"GET /v1/organizations/org/environments/env/apiproducts", "retrying GET", "200 OK"} {
+		if !strings.Contains(errOut, want) {
+			t.Errorf("want stderr containing %q, got:\n%s", want, errOut)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLoginURL is the Edge OAuth2 token endpoint for legacy SaaS
+	DefaultLoginURL = "https://login.apigee.com/oauth/token"
+
+	// Edge OAuth2 client credentials used by Apigee command line tools
+	edgeLoginClientID     = "edgecli"
+	edgeLoginClientSecret = "edgeclisecret"
+
+	tokenCacheDir  = ".apigee-remote-service"
+	tokenCacheFile = "token.json"
+)
+
+// LoginOptions are the credentials for an Edge OAuth2 login
+type LoginOptions struct {
+	// Optional. Defaults to DefaultLoginURL. SSO zones have their own login URL.
+	LoginURL string
+
+	Username string
+	Password string
+
+	// Optional. One-time code for accounts with multi-factor authentication.
+	MFACode string
+
+	// Optional. One-time SSO passcode, used instead of Username and Password.
+	Passcode string
+}
+
+// OAuthToken is an Edge OAuth2 access token and the refresh token used to renew it
+type OAuthToken struct {
+	LoginURL     string    `json:"login_url"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// valid returns true if the access token will not expire within the next minute
+func (t *OAuthToken) valid() bool {
+	return t.AccessToken != "" && time.Now().Add(time.Minute).Before(t.Expiry)
+}
+
+// Login performs the Edge OAuth2 password grant and returns the tokens
+func Login(ctx context.Context, client *http.Client, o LoginOptions) (*OAuthToken, error) {
+	loginURL := o.LoginURL
+	if loginURL == "" {
+		loginURL = DefaultLoginURL
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "password")
+	if o.Passcode != "" {
+		form.Set("response_type", "token")
+		form.Set("passcode", o.Passcode)
+	} else {
+		if o.Username == "" || o.Password == "" {
+			return nil, errors.New("username and password or passcode are required")
+		}
+		form.Set("username", o.Username)
+		form.Set("password", o.Password)
+	}
+
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		return nil, err
+	}
+	if o.MFACode != "" {
+		q := u.Query()
+		q.Set("mfa_token", o.MFACode)
+		u.RawQuery = q.Encode()
+	}
+
+	return requestOAuthToken(ctx, client, u.String(), form, loginURL)
+}
+
+// refreshOAuthToken renews an access token using its refresh token
+func refreshOAuthToken(ctx context.Context, client *http.Client, token *OAuthToken) (*OAuthToken, error) {
+	if token.RefreshToken == "" {
+		return nil, errors.New("no refresh token, run login again")
+	}
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", token.RefreshToken)
+	refreshed, err := requestOAuthToken(ctx, client, token.LoginURL, form, token.LoginURL)
+	if err != nil {
+		return nil, err
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	return refreshed, nil
+}
+
+func requestOAuthToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values, loginURL string) (*OAuthToken, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", appJSON)
+	req.SetBasicAuth(edgeLoginClientID, edgeLoginClientSecret)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var tr oauthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("parsing token response: %v", err)
+	}
+	if tr.AccessToken == "" {
+		return nil, errors.New("no access token in login response")
+	}
+	return &OAuthToken{
+		LoginURL:     loginURL,
+		AccessToken:  tr.AccessToken,
+		RefreshToken: tr.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// DefaultTokenCachePath returns the file in which login tokens are cached
+func DefaultTokenCachePath() string {
+	return filepath.Join(os.ExpandEnv("${HOME}"), tokenCacheDir, tokenCacheFile)
+}
+
+// SaveOAuthToken writes the token to the cache file, readable only by the user
+func SaveOAuthToken(path string, token *OAuthToken) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil { // file may predate this process
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadOAuthToken reads a token from the cache file
+func LoadOAuthToken(path string) (*OAuthToken, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	token := &OAuthToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("parsing cached token %s: %v", path, err)
+	}
+	return token, nil
+}
+
+// loginCredentials applies cached login tokens, refreshing and re-caching
+// them when they expire
+type loginCredentials struct {
+	path   string
+	client *http.Client
+
+	mu    sync.Mutex
+	token *OAuthToken
+}
+
+func newLoginCredentials(path string, client *http.Client) (*loginCredentials, error) {
+	if path == "" {
+		path = DefaultTokenCachePath()
+	}
+	token, err := LoadOAuthToken(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("no cached login token, run the login command first")
+		}
+		return nil, err
+	}
+	return &loginCredentials{path: path, client: client, token: token}, nil
+}
+
+func (l *loginCredentials) ApplyTo(req *http.Request) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.token.valid() {
+		token, err := refreshOAuthToken(req.Context(), l.client, l.token)
+		if err != nil {
+			return fmt.Errorf("refreshing login token: %v", err)
+		}
+		if err := SaveOAuthToken(l.path, token); err != nil {
+			return fmt.Errorf("caching login token: %v", err)
+		}
+		l.token = token
+	}
+
+	req.Header.Set("Authorization", "Bearer "+l.token.AccessToken)
+	return nil
+}
+
+// hasCachedLogin returns true if a login token cache file exists
+func hasCachedLogin(path string) bool {
+	if path == "" {
+		path = DefaultTokenCachePath()
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginCredentials(t *testing.T) {
+	var auths []string
+	var refreshes int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/oauth/token" {
+			refreshes++
+			r.ParseForm()
+			if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != "/refresh/" {
+				t.Errorf("unexpected refresh form: %v", r.PostForm)
+			}
+			w.Write([]byte(`{"access_token": "/refreshed/", "expires_in": 1799}`))
+			return
+		}
+		auths = append(auths, r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	expired := &OAuthToken{
+		LoginURL:     ts.URL + "/oauth/token",
+		AccessToken:  "/expired/",
+		RefreshToken: "/refresh/",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+	if err := SaveOAuthToken(tokenFile, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Auth: &EdgeAuth{Method: AuthLogin, TokenCachePath: tokenFile}})
+	for i := 0; i < 2; i++ {
+		req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Do(req, nil); err != nil {
+			t.Fatalf("want no error: %v", err)
+		}
+	}
+
+	// refreshed once, then reused
+	if refreshes != 1 {
+		t.Errorf("want 1 refresh, got: %d", refreshes)
+	}
+	if len(auths) != 2 || auths[0] != "Bearer /refreshed/" || auths[1] != "Bearer /refreshed/" {
+		t.Errorf("want refreshed bearer token, got: %v", auths)
+	}
+	cached, err := LoadOAuthToken(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.AccessToken != "/refreshed/" || cached.RefreshToken != "/refresh/" {
+		t.Errorf("want refreshed token cached, got: %#v", cached)
+	}
+	if info, err := os.Stat(tokenFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("want token cache readable only by the user, got: %v, %v", info.Mode(), err)
+	}
+}
+
+func TestLoginCredentialsNotCached(t *testing.T) {
+	auth := &EdgeAuth{Method: AuthLogin, TokenCachePath: filepath.Join(os.TempDir(), "no-such-token")}
+	if _, err := NewEdgeClient(&EdgeClientOptions{MgmtURL: "http://localhost", Auth: auth}); err == nil || !strings.Contains(err.Error(), "run the login command first") {
+		t.Errorf("want no cached login error, got: %v", err)
+	}
+}
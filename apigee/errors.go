@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Errors matched by an *ErrorResponse with the corresponding status code.
+// Use errors.Is to test for them.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("already exists")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// Is reports whether the response status corresponds to target, one of the
+// Err sentinel errors
+func (r *ErrorResponse) Is(target error) bool {
+	if r.Response == nil {
+		return false
+	}
+	switch r.Response.StatusCode {
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return false
+}
+
+// edgeFault is the Edge error format: {"code": "...", "message": "..."}
+type edgeFault struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// parseErrorMessage parses an error body in either the GCP format,
+// {"error": {"code": 404, "message": "...", "status": "NOT_FOUND"}}, or the
+// Edge format. The Edge fault code is returned as the Status. Bodies in
+// neither format are returned as the Message.
+func parseErrorMessage(data []byte) ResponseErrorMessage {
+	var gcp struct {
+		Error *ResponseErrorMessage `json:"error"`
+	}
+	if err := json.Unmarshal(data, &gcp); err == nil && gcp.Error != nil {
+		return *gcp.Error
+	}
+
+	var edge edgeFault
+	if err := json.Unmarshal(data, &edge); err == nil && (edge.Code != "" || edge.Message != "") {
+		return ResponseErrorMessage{
+			Message: edge.Message,
+			Status:  edge.Code,
+		}
+	}
+
+	return ResponseErrorMessage{
+		Message: string(data),
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		want    error
+		wantMsg string
+	}{
+		{http.StatusUnauthorized, `{"code": "steps.oauth.v2.FailedToResolveToken", "message": "Invalid credentials"}`,
+			ErrUnauthorized, "401 Invalid credentials (steps.oauth.v2.FailedToResolveToken)"},
+		{http.StatusForbidden, `{"error": {"code": 403, "message": "Permission denied", "status": "PERMISSION_DENIED"}}`,
+			ErrForbidden, "403 Permission denied (PERMISSION_DENIED)"},
+		{http.StatusNotFound, ``, ErrNotFound, "404 Not Found"},
+		{http.StatusConflict, `{"code": "keymanagement.service.DeveloperAlreadyExists"}`,
+			ErrConflict, "409 Conflict (keymanagement.service.DeveloperAlreadyExists)"},
+		{http.StatusTooManyRequests, `slow down`, ErrRateLimited, "429 slow down"},
+		{http.StatusInternalServerError, `{"error": {"message": "boom"}}`, nil, "500 boom"},
+	}
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+
+		client := newTestClient(t, ts.URL, EdgeClientOptions{})
+		req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Do(req, nil)
+		ts.Close()
+
+		var errResp *ErrorResponse
+		if !errors.As(err, &errResp) {
+			t.Errorf("%d want *ErrorResponse, got: %v", test.status, err)
+			continue
+		}
+		wantErr := "GET " + ts.URL + "/v1/organizations/org/environments/env/apiproducts: " + test.wantMsg
+		if err.Error() != wantErr {
+			t.Errorf("%d want error %q, got: %q", test.status, wantErr, err)
+		}
+		for _, target := range []error{ErrNotFound, ErrConflict, ErrUnauthorized, ErrForbidden, ErrRateLimited} {
+			if got := errors.Is(err, target); got != (target == test.want) {
+				t.Errorf("%d errors.Is(%v) want %t, got: %t", test.status, target, !got, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+const (
+	// GoogleCredentialsEnv is the environment variable that names the
+	// Application Default Credentials file
+	GoogleCredentialsEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+
+	googleTokenURL       = "https://oauth2.googleapis.com/token"
+	googleCloudScope     = "https://www.googleapis.com/auth/cloud-platform"
+	googleJWTGrantType   = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	googleTokenLifetime  = time.Hour
+	googleRefreshEarly   = time.Minute // refresh before a token expires
+	serviceAccountType   = "service_account"
+	authorizedUserType   = "authorized_user"
+	gcloudConfigDir      = "gcloud"
+	adcCredentialsFile   = "application_default_credentials.json"
+	adcCredentialsSubdir = ".config"
+)
+
+// googleCredentials is a Google service account key or authorized user
+// credentials file, as created by the Cloud Console or gcloud
+type googleCredentials struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type googleTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+// googleTokenSource retrieves Google OAuth access tokens and caches them
+// until they are about to expire
+type googleTokenSource struct {
+	creds      googleCredentials
+	privateKey *rsa.PrivateKey
+	client     *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// findADCPath returns the Application Default Credentials file path from
+// GOOGLE_APPLICATION_CREDENTIALS or the gcloud well-known location
+func findADCPath() (string, error) {
+	if p := os.Getenv(GoogleCredentialsEnv); p != "" {
+		return p, nil
+	}
+
+	var p string
+	if runtime.GOOS == "windows" {
+		p = filepath.Join(os.Getenv("APPDATA"), gcloudConfigDir, adcCredentialsFile)
+	} else {
+		p = filepath.Join(os.ExpandEnv("${HOME}"), adcCredentialsSubdir, gcloudConfigDir, adcCredentialsFile)
+	}
+	if _, err := os.Stat(p); err != nil {
+		return "", fmt.Errorf("no application default credentials: set %s or run `gcloud auth application-default login`",
+			GoogleCredentialsEnv)
+	}
+	return p, nil
+}
+
+// newGoogleTokenSourceFor loads the credentials file, or discovers the
+// Application Default Credentials if credentialsPath is empty
+func newGoogleTokenSourceFor(credentialsPath string, client *http.Client) (*googleTokenSource, error) {
+	if credentialsPath == "" {
+		var err error
+		if credentialsPath, err = findADCPath(); err != nil {
+			return nil, err
+		}
+	}
+	return newGoogleTokenSource(credentialsPath, client)
+}
+
+// newGoogleTokenSource loads a service account or authorized user credentials file
+func newGoogleTokenSource(credentialsPath string, client *http.Client) (*googleTokenSource, error) {
+	data, err := ioutil.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading Google credentials: %v", err)
+	}
+	ts := &googleTokenSource{client: client}
+	if err := json.Unmarshal(data, &ts.creds); err != nil {
+		return nil, fmt.Errorf("parsing Google credentials %s: %v", credentialsPath, err)
+	}
+	if ts.creds.TokenURI == "" {
+		ts.creds.TokenURI = googleTokenURL
+	}
+
+	switch ts.creds.Type {
+	case serviceAccountType:
+		if ts.creds.ClientEmail == "" {
+			return nil, fmt.Errorf("service account %s has no client_email", credentialsPath)
+		}
+		if ts.privateKey, err = parseRSAPrivateKey([]byte(ts.creds.PrivateKey)); err != nil {
+			return nil, fmt.Errorf("service account %s private_key: %v", credentialsPath, err)
+		}
+	case authorizedUserType:
+		if ts.creds.RefreshToken == "" {
+			return nil, fmt.Errorf("credentials %s have no refresh_token", credentialsPath)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Google credentials type %q in %s", ts.creds.Type, credentialsPath)
+	}
+	return ts, nil
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+	return rsaKey, nil
+}
+
+// Token returns a valid access token, refreshing it if necessary
+func (ts *googleTokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Now().Add(googleRefreshEarly).Before(ts.expires) {
+		return ts.token, nil
+	}
+
+	form := url.Values{}
+	if ts.creds.Type == serviceAccountType {
+		assertion, err := ts.signAssertion()
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", googleJWTGrantType)
+		form.Set("assertion", assertion)
+	} else {
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", ts.creds.ClientID)
+		form.Set("client_secret", ts.creds.ClientSecret)
+		form.Set("refresh_token", ts.creds.RefreshToken)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.creds.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", appJSON)
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("retrieving Google access token: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := CheckResponse(resp); err != nil {
+		return "", fmt.Errorf("retrieving Google access token: %v", err)
+	}
+
+	var tr googleTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("parsing Google access token: %v", err)
+	}
+	if tr.AccessToken == "" {
+		return "", errors.New("no access token in Google token response")
+	}
+
+	ts.token = tr.AccessToken
+	ts.expires = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	return ts.token, nil
+}
+
+// ApplyTo applies a valid access token onto a request
+func (ts *googleTokenSource) ApplyTo(req *http.Request) error {
+	token, err := ts.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// signAssertion creates the JWT exchanged for a service account access token
+func (ts *googleTokenSource) signAssertion() (string, error) {
+	now := time.Now()
+	token := jwt.New()
+	token.Set(jwt.IssuerKey, ts.creds.ClientEmail)
+	token.Set(jwt.AudienceKey, ts.creds.TokenURI)
+	token.Set(jwt.IssuedAtKey, now.Unix())
+	token.Set(jwt.ExpirationKey, now.Add(googleTokenLifetime).Unix())
+	token.Set("scope", googleCloudScope)
+
+	signed, err := token.Sign(jwa.RS256, ts.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("signing service account assertion: %v", err)
+	}
+	return string(signed), nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+// googleTokenServer records the token grants and responds with status
+func googleTokenServer(grants *[]url.Values, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		*grants = append(*grants, r.PostForm)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(googleTokenResponse{AccessToken: "/access/", ExpiresIn: 3600, TokenType: "Bearer"})
+	}))
+}
+
+// writeGoogleCredentials writes creds as a credentials file in dir
+func writeGoogleCredentials(t *testing.T, dir, name string, creds map[string]string) string {
+	data, _ := json.Marshal(creds)
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestGoogleServiceAccount(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	var grants []url.Values
+	ts := googleTokenServer(&grants, http.StatusOK)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "google-creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := writeGoogleCredentials(t, dir, "sa.json", map[string]string{
+		"type":         "service_account",
+		"client_email": "sa@project.iam.gserviceaccount.com",
+		"private_key":  string(keyPEM),
+		"token_uri":    ts.URL,
+	})
+
+	source, err := newGoogleTokenSource(file, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if token, err := source.Token(context.Background()); err != nil || token != "/access/" {
+			t.Errorf("want token /access/, got: %q, %v", token, err)
+		}
+	}
+
+	// the token is cached until it's about to expire
+	if len(grants) != 1 || grants[0].Get("grant_type") != googleJWTGrantType {
+		t.Fatalf("want one jwt-bearer grant, got: %v", grants)
+	}
+	assertion := []byte(grants[0].Get("assertion"))
+	if _, err := jws.Verify(assertion, jwa.RS256, &privateKey.PublicKey); err != nil {
+		t.Errorf("invalid assertion signature: %v", err)
+	}
+	token, err := jwt.ParseBytes(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Issuer() != "sa@project.iam.gserviceaccount.com" || token.Audience()[0] != ts.URL {
+		t.Errorf("unexpected assertion claims: %v", token)
+	}
+}
+
+func TestGoogleApplicationDefaultCredentials(t *testing.T) {
+	var grants []url.Values
+	ts := googleTokenServer(&grants, http.StatusUnauthorized)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "google-creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := writeGoogleCredentials(t, dir, "adc.json", map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "/client/",
+		"client_secret": "/secret/",
+		"refresh_token": "/refresh/",
+		"token_uri":     ts.URL,
+	})
+
+	// discovered from the environment
+	defer os.Setenv(GoogleCredentialsEnv, os.Getenv(GoogleCredentialsEnv))
+	os.Setenv(GoogleCredentialsEnv, file)
+	source, err := newGoogleTokenSourceFor("", http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Token(context.Background()); err == nil || !strings.Contains(err.Error(), "retrieving Google access token") {
+		t.Errorf("want token error, got: %v", err)
+	}
+	if len(grants) != 1 || grants[0].Get("grant_type") != "refresh_token" || grants[0].Get("refresh_token") != "/refresh/" {
+		t.Errorf("want refresh_token grant, got: %v", grants)
+	}
+}
+
+func TestGoogleCredentialsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "google-creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]map[string]string{
+		"no client_email":  {"type": "service_account", "private_key": "key"},
+		"private_key":      {"type": "service_account", "client_email": "sa@project", "private_key": "key"},
+		"no refresh_token": {"type": "authorized_user"},
+		"unsupported":      {"type": "external_account"},
+	}
+	for want, creds := range tests {
+		file := writeGoogleCredentials(t, dir, "creds.json", creds)
+		if _, err := newGoogleTokenSource(file, http.DefaultClient); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("want %q error, got: %v", want, err)
+		}
+	}
+}
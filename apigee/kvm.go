@@ -15,6 +15,7 @@
 package apigee
 
 import (
+	"context"
 	"path"
 )
 
@@ -24,9 +25,15 @@ const kvmPath = "keyvaluemaps"
 // dealing with kvm.
 type KVMService interface {
 	Get(mapname string) (*KVM, *Response, error)
+	GetWithContext(ctx context.Context, mapname string) (*KVM, *Response, error)
 	Create(kvm KVM) (*Response, error)
+	CreateWithContext(ctx context.Context, kvm KVM) (*Response, error)
 	UpdateEntry(kvmName string, entry Entry) (*Response, error)
+	UpdateEntryWithContext(ctx context.Context, kvmName string, entry Entry) (*Response, error)
 	AddEntry(kvmName string, entry Entry) (*Response, error)
+	AddEntryWithContext(ctx context.Context, kvmName string, entry Entry) (*Response, error)
+	Delete(mapname string) (*Response, error)
+	DeleteWithContext(ctx context.Context, mapname string) (*Response, error)
 }
 
 // Entry is an entry in the KVM
@@ -61,8 +68,13 @@ var _ KVMService = &KVMServiceOp{}
 
 // Get returns a response given a KVM map name
 func (s *KVMServiceOp) Get(mapname string) (*KVM, *Response, error) {
+	return s.GetWithContext(context.Background(), mapname)
+}
+
+// GetWithContext is Get with a Context for the request
+func (s *KVMServiceOp) GetWithContext(ctx context.Context, mapname string) (*KVM, *Response, error) {
 	path := path.Join(kvmPath, mapname)
-	req, e := s.client.NewRequest("GET", path, nil)
+	req, e := s.client.NewRequestWithContext(ctx, "GET", path, nil)
 	if e != nil {
 		return nil, nil, e
 	}
@@ -76,8 +88,13 @@ func (s *KVMServiceOp) Get(mapname string) (*KVM, *Response, error) {
 
 // Create creates a KVM and returns a response
 func (s *KVMServiceOp) Create(kvm KVM) (*Response, error) {
+	return s.CreateWithContext(context.Background(), kvm)
+}
+
+// CreateWithContext is Create with a Context for the request
+func (s *KVMServiceOp) CreateWithContext(ctx context.Context, kvm KVM) (*Response, error) {
 	path := path.Join(kvmPath)
-	req, e := s.client.NewRequest("POST", path, kvm)
+	req, e := s.client.NewRequestWithContext(ctx, "POST", path, kvm)
 	if e != nil {
 		return nil, e
 	}
@@ -87,8 +104,13 @@ func (s *KVMServiceOp) Create(kvm KVM) (*Response, error) {
 
 // UpdateEntry updates a KVM entry
 func (s *KVMServiceOp) UpdateEntry(kvmName string, entry Entry) (*Response, error) {
+	return s.UpdateEntryWithContext(context.Background(), kvmName, entry)
+}
+
+// UpdateEntryWithContext is UpdateEntry with a Context for the request
+func (s *KVMServiceOp) UpdateEntryWithContext(ctx context.Context, kvmName string, entry Entry) (*Response, error) {
 	path := path.Join(kvmPath, kvmName, "entries", entry.Name)
-	req, e := s.client.NewRequest("POST", path, entry)
+	req, e := s.client.NewRequestWithContext(ctx, "POST", path, entry)
 	if e != nil {
 		return nil, e
 	}
@@ -98,11 +120,31 @@ func (s *KVMServiceOp) UpdateEntry(kvmName string, entry Entry) (*Response, erro
 
 // AddEntry add an entry to the KVM
 func (s *KVMServiceOp) AddEntry(kvmName string, entry Entry) (*Response, error) {
+	return s.AddEntryWithContext(context.Background(), kvmName, entry)
+}
+
+// AddEntryWithContext is AddEntry with a Context for the request
+func (s *KVMServiceOp) AddEntryWithContext(ctx context.Context, kvmName string, entry Entry) (*Response, error) {
 	path := path.Join(kvmPath, kvmName, "entries")
-	req, e := s.client.NewRequest("POST", path, entry)
+	req, e := s.client.NewRequestWithContext(ctx, "POST", path, entry)
 	if e != nil {
 		return nil, e
 	}
 	resp, e := s.client.Do(req, &entry)
 	return resp, e
 }
+
+// Delete deletes a KVM
+func (s *KVMServiceOp) Delete(mapname string) (*Response, error) {
+	return s.DeleteWithContext(context.Background(), mapname)
+}
+
+// DeleteWithContext is Delete with a Context for the request
+func (s *KVMServiceOp) DeleteWithContext(ctx context.Context, mapname string) (*Response, error) {
+	path := path.Join(kvmPath, mapname)
+	req, e := s.client.NewRequestWithContext(ctx, "DELETE", path, nil)
+	if e != nil {
+		return nil, e
+	}
+	return s.client.Do(req, nil)
+}
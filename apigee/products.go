@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"context"
+	"path"
+)
+
+const productsPath = "apiproducts"
+
+// ProductsService is an interface for interfacing with the Apigee Edge Admin API
+// dealing with apiproducts.
+type ProductsService interface {
+	Get(name string) (*Product, *Response, error)
+	GetWithContext(ctx context.Context, name string) (*Product, *Response, error)
+	Create(product Product) (*Product, *Response, error)
+	CreateWithContext(ctx context.Context, product Product) (*Product, *Response, error)
+	Update(product Product) (*Product, *Response, error)
+	UpdateWithContext(ctx context.Context, product Product) (*Product, *Response, error)
+	Delete(name string) (*Response, error)
+	DeleteWithContext(ctx context.Context, name string) (*Response, error)
+}
+
+// Product represents an Apigee API Product
+type Product struct {
+	Name          string      `json:"name,omitempty"`
+	DisplayName   string      `json:"displayName,omitempty"`
+	Description   string      `json:"description,omitempty"`
+	ApprovalType  string      `json:"approvalType,omitempty"`
+	Attributes    []Attribute `json:"attributes,omitempty"`
+	APIResources  []string    `json:"apiResources,omitempty"`
+	Environments  []string    `json:"environments,omitempty"`
+	Proxies       []string    `json:"proxies,omitempty"`
+	Scopes        []string    `json:"scopes,omitempty"`
+	Quota         string      `json:"quota,omitempty"`
+	QuotaInterval string      `json:"quotaInterval,omitempty"`
+	QuotaTimeUnit string      `json:"quotaTimeUnit,omitempty"`
+}
+
+// Attribute is a name-value attribute of an Apigee entity
+type Attribute struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// ProductsServiceOp represents operations against Apigee API Products
+type ProductsServiceOp struct {
+	client *EdgeClient
+}
+
+var _ ProductsService = &ProductsServiceOp{}
+
+// Get retrieves an API Product by name
+func (s *ProductsServiceOp) Get(name string) (*Product, *Response, error) {
+	return s.GetWithContext(context.Background(), name)
+}
+
+// GetWithContext is Get with a Context for the request
+func (s *ProductsServiceOp) GetWithContext(ctx context.Context, name string) (*Product, *Response, error) {
+	path := path.Join(productsPath, name)
+	req, e := s.client.NewRequestNoEnvWithContext(ctx, "GET", path, nil)
+	if e != nil {
+		return nil, nil, e
+	}
+	returnedProduct := Product{}
+	resp, e := s.client.Do(req, &returnedProduct)
+	if e != nil {
+		return nil, resp, e
+	}
+	return &returnedProduct, resp, e
+}
+
+// Create creates an API Product and returns the created Product
+func (s *ProductsServiceOp) Create(product Product) (*Product, *Response, error) {
+	return s.CreateWithContext(context.Background(), product)
+}
+
+// CreateWithContext is Create with a Context for the request
+func (s *ProductsServiceOp) CreateWithContext(ctx context.Context, product Product) (*Product, *Response, error) {
+	req, e := s.client.NewRequestNoEnvWithContext(ctx, "POST", productsPath, product)
+	if e != nil {
+		return nil, nil, e
+	}
+	returnedProduct := Product{}
+	resp, e := s.client.Do(req, &returnedProduct)
+	if e != nil {
+		return nil, resp, e
+	}
+	return &returnedProduct, resp, e
+}
+
+// Update replaces an existing API Product and returns the updated Product
+func (s *ProductsServiceOp) Update(product Product) (*Product, *Response, error) {
+	return s.UpdateWithContext(context.Background(), product)
+}
+
+// UpdateWithContext is Update with a Context for the request
+func (s *ProductsServiceOp) UpdateWithContext(ctx context.Context, product Product) (*Product, *Response, error) {
+	path := path.Join(productsPath, product.Name)
+	req, e := s.client.NewRequestNoEnvWithContext(ctx, "PUT", path, product)
+	if e != nil {
+		return nil, nil, e
+	}
+	returnedProduct := Product{}
+	resp, e := s.client.Do(req, &returnedProduct)
+	if e != nil {
+		return nil, resp, e
+	}
+	return &returnedProduct, resp, e
+}
+
+// Delete deletes an API Product
+func (s *ProductsServiceOp) Delete(name string) (*Response, error) {
+	return s.DeleteWithContext(context.Background(), name)
+}
+
+// DeleteWithContext is Delete with a Context for the request
+func (s *ProductsServiceOp) DeleteWithContext(ctx context.Context, name string) (*Response, error) {
+	path := path.Join(productsPath, name)
+	req, e := s.client.NewRequestNoEnvWithContext(ctx, "DELETE", path, nil)
+	if e != nil {
+		return nil, e
+	}
+	return s.client.Do(req, nil)
+}
@@ -17,6 +17,7 @@ package apigee
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -38,16 +39,28 @@ const proxiesPath = "apis"
 type ProxiesService interface {
 	// List() ([]string, *Response, error)
 	Get(string) (*Proxy, *Response, error)
+	GetWithContext(context.Context, string) (*Proxy, *Response, error)
 	Import(proxyName string, source string) (*ProxyRevision, *Response, error)
-	// Delete(string) (*DeletedProxyInfo, *Response, error)
-	// DeleteRevision(string, Revision) (*ProxyRevision, *Response, error)
+	ImportWithContext(ctx context.Context, proxyName string, source string) (*ProxyRevision, *Response, error)
+	Delete(string) (*DeletedProxyInfo, *Response, error)
+	DeleteWithContext(context.Context, string) (*DeletedProxyInfo, *Response, error)
+	DeleteRevision(string, Revision) (*ProxyRevision, *Response, error)
+	DeleteRevisionWithContext(context.Context, string, Revision) (*ProxyRevision, *Response, error)
 	Deploy(string, string, Revision) (*ProxyRevisionDeployment, *Response, error)
+	DeployWithContext(context.Context, string, string, Revision) (*ProxyRevisionDeployment, *Response, error)
 	Undeploy(string, string, Revision) (*ProxyRevisionDeployment, *Response, error)
+	UndeployWithContext(context.Context, string, string, Revision) (*ProxyRevisionDeployment, *Response, error)
 	// Export(string, Revision) (string, *Response, error)
 	GetDeployment(proxy string) (*EnvironmentDeployment, *Response, error)
+	GetDeploymentWithContext(ctx context.Context, proxy string) (*EnvironmentDeployment, *Response, error)
 	GetDeployedRevision(proxy string) (*Revision, error)
+	GetDeployedRevisionWithContext(ctx context.Context, proxy string) (*Revision, error)
 	GetGCPDeployments(proxy string) ([]GCPDeployment, *Response, error)
+	GetGCPDeploymentsWithContext(ctx context.Context, proxy string) ([]GCPDeployment, *Response, error)
 	GetGCPDeployedRevision(proxy string) (*Revision, error)
+	GetGCPDeployedRevisionWithContext(ctx context.Context, proxy string) (*Revision, error)
+	GetDeployedEnvironments(proxy string) ([]string, error)
+	GetDeployedEnvironmentsWithContext(ctx context.Context, proxy string) ([]string, error)
 }
 
 // ProxiesServiceOp represents operations against Apigee proxies
@@ -179,8 +192,13 @@ type DeletedProxyInfo struct {
 // Get retrieves the information about an API Proxy in an organization, information including
 // the list of available revisions, and the created and last modified dates and actors.
 func (s *ProxiesServiceOp) Get(proxy string) (*Proxy, *Response, error) {
+	return s.GetWithContext(context.Background(), proxy)
+}
+
+// GetWithContext is Get with a Context for the request
+func (s *ProxiesServiceOp) GetWithContext(ctx context.Context, proxy string) (*Proxy, *Response, error) {
 	urlPath := path.Join(proxiesPath, proxy)
-	req, e := s.client.NewRequestNoEnv("GET", urlPath, nil)
+	req, e := s.client.NewRequestNoEnvWithContext(ctx, "GET", urlPath, nil)
 	if e != nil {
 		return nil, nil, e
 	}
@@ -277,6 +295,11 @@ func zipDirectory(source string, target string, filter func(string) bool) error
 // the path of a zip file containing an API Proxy bundle. Returns the API proxy revision information.
 // This method does not deploy the imported proxy. See the Deploy method.
 func (s *ProxiesServiceOp) Import(proxyName string, source string) (*ProxyRevision, *Response, error) {
+	return s.ImportWithContext(context.Background(), proxyName, source)
+}
+
+// ImportWithContext is Import with a Context for the request
+func (s *ProxiesServiceOp) ImportWithContext(ctx context.Context, proxyName string, source string) (*ProxyRevision, *Response, error) {
 	info, err := os.Stat(source)
 	if err != nil {
 		return nil, nil, err
@@ -327,7 +350,7 @@ func (s *ProxiesServiceOp) Import(proxyName string, source string) (*ProxyRevisi
 
 	var req *http.Request
 	if !s.client.IsGCPManaged {
-		req, err = s.client.NewRequestNoEnv("POST", urlPath, ioreader)
+		req, err = s.client.NewRequestNoEnvWithContext(ctx, "POST", urlPath, ioreader)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -343,7 +366,7 @@ func (s *ProxiesServiceOp) Import(proxyName string, source string) (*ProxyRevisi
 		}
 		w.Close()
 
-		req, err = s.client.NewRequestNoEnv("POST", urlPath, &b)
+		req, err = s.client.NewRequestNoEnvWithContext(ctx, "POST", urlPath, &b)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -351,7 +374,7 @@ func (s *ProxiesServiceOp) Import(proxyName string, source string) (*ProxyRevisi
 	}
 
 	returnedProxyRevision := ProxyRevision{}
-	res, err := s.client.Do(req, &returnedProxyRevision)
+	res, err := s.client.Do(withoutTimeout(req), &returnedProxyRevision)
 	if err != nil {
 		return nil, res, err
 	}
@@ -398,30 +421,40 @@ func (s *ProxiesServiceOp) Import(proxyName string, source string) (*ProxyRevisi
 // 	return filename, resp, e
 // }
 
-// // DeleteRevision deletes a specific revision of an API Proxy from an organization.
-// // The revision must exist, and must not be currently deployed.
-// func (s *ProxiesServiceOp) DeleteRevision(proxyName string, rev Revision) (*ProxyRevision, *Response, error) {
-// 	urlPath := path.Join(proxiesPath, proxyName, "revisions", fmt.Sprintf("%d", rev))
-// 	req, e := s.client.NewRequestNoEnv("DELETE", urlPath, nil)
-// 	if e != nil {
-// 		return nil, nil, e
-// 	}
-// 	proxyRev := ProxyRevision{}
-// 	resp, e := s.client.Do(req, &proxyRev)
-// 	if e != nil {
-// 		return nil, resp, e
-// 	}
-// 	return &proxyRev, resp, e
-// }
+// DeleteRevision deletes a specific revision of an API Proxy from an organization.
+// The revision must exist, and must not be currently deployed.
+func (s *ProxiesServiceOp) DeleteRevision(proxyName string, rev Revision) (*ProxyRevision, *Response, error) {
+	return s.DeleteRevisionWithContext(context.Background(), proxyName, rev)
+}
+
+// DeleteRevisionWithContext is DeleteRevision with a Context for the request
+func (s *ProxiesServiceOp) DeleteRevisionWithContext(ctx context.Context, proxyName string, rev Revision) (*ProxyRevision, *Response, error) {
+	urlPath := path.Join(proxiesPath, proxyName, "revisions", fmt.Sprintf("%d", rev))
+	req, e := s.client.NewRequestNoEnvWithContext(ctx, "DELETE", urlPath, nil)
+	if e != nil {
+		return nil, nil, e
+	}
+	proxyRev := ProxyRevision{}
+	resp, e := s.client.Do(req, &proxyRev)
+	if e != nil {
+		return nil, resp, e
+	}
+	return &proxyRev, resp, e
+}
 
 // Undeploy a specific revision of an API Proxy from a particular environment within an Edge organization.
 func (s *ProxiesServiceOp) Undeploy(proxyName, env string, rev Revision) (*ProxyRevisionDeployment, *Response, error) {
+	return s.UndeployWithContext(context.Background(), proxyName, env, rev)
+}
+
+// UndeployWithContext is Undeploy with a Context for the request
+func (s *ProxiesServiceOp) UndeployWithContext(ctx context.Context, proxyName, env string, rev Revision) (*ProxyRevisionDeployment, *Response, error) {
 	urlPath := path.Join(proxiesPath, proxyName, "revisions", fmt.Sprintf("%d", rev), "deployments")
 
 	var req *http.Request
 	var err error
 	if s.client.IsGCPManaged {
-		req, err = s.client.NewRequest("DELETE", urlPath, nil)
+		req, err = s.client.NewRequestWithContext(ctx, "DELETE", urlPath, nil)
 	} else {
 		origURL, err := url.Parse(urlPath)
 		if err != nil {
@@ -432,7 +465,7 @@ func (s *ProxiesServiceOp) Undeploy(proxyName, env string, rev Revision) (*Proxy
 		q.Add("env", env)
 		origURL.RawQuery = q.Encode()
 		urlPath = origURL.String()
-		req, err = s.client.NewRequestNoEnv("POST", urlPath, nil)
+		req, err = s.client.NewRequestNoEnvWithContext(ctx, "POST", urlPath, nil)
 	}
 	if err != nil {
 		return nil, nil, err
@@ -448,6 +481,11 @@ func (s *ProxiesServiceOp) Undeploy(proxyName, env string, rev Revision) (*Proxy
 
 // Deploy a revision of an API proxy to a specific environment within an organization.
 func (s *ProxiesServiceOp) Deploy(proxyName, env string, rev Revision) (*ProxyRevisionDeployment, *Response, error) {
+	return s.DeployWithContext(context.Background(), proxyName, env, rev)
+}
+
+// DeployWithContext is Deploy with a Context for the request
+func (s *ProxiesServiceOp) DeployWithContext(ctx context.Context, proxyName, env string, rev Revision) (*ProxyRevisionDeployment, *Response, error) {
 	urlPath := path.Join(proxiesPath, proxyName, "revisions", fmt.Sprintf("%d", rev), "deployments")
 	// append the query params
 	origURL, err := url.Parse(urlPath)
@@ -464,44 +502,54 @@ func (s *ProxiesServiceOp) Deploy(proxyName, env string, rev Revision) (*ProxyRe
 	origURL.RawQuery = q.Encode()
 	urlPath = origURL.String()
 
-	req, e := s.client.NewRequest("POST", urlPath, nil)
+	req, e := s.client.NewRequestWithContext(ctx, "POST", urlPath, nil)
 	if e != nil {
 		return nil, nil, e
 	}
 
 	deployment := ProxyRevisionDeployment{}
-	resp, e := s.client.Do(req, &deployment)
+	resp, e := s.client.Do(withoutTimeout(req), &deployment)
 	if e != nil {
 		return nil, resp, e
 	}
 	return &deployment, resp, e
 }
 
-// // Delete an API Proxy and all its revisions from an organization. This method
-// // will fail if any of the revisions of the named API Proxy are currently deployed
-// // in any environment.
-// func (s *ProxiesServiceOp) Delete(proxyName string) (*DeletedProxyInfo, *Response, error) {
-// 	urlPath := path.Join(proxiesPath, proxyName)
-// 	req, e := s.client.NewRequestNoEnv("DELETE", urlPath, nil)
-// 	if e != nil {
-// 		return nil, nil, e
-// 	}
-// 	proxy := DeletedProxyInfo{}
-// 	resp, e := s.client.Do(req, &proxy)
-// 	if e != nil {
-// 		return nil, resp, e
-// 	}
-// 	return &proxy, resp, e
-// }
+// Delete an API Proxy and all its revisions from an organization. This method
+// will fail if any of the revisions of the named API Proxy are currently deployed
+// in any environment.
+func (s *ProxiesServiceOp) Delete(proxyName string) (*DeletedProxyInfo, *Response, error) {
+	return s.DeleteWithContext(context.Background(), proxyName)
+}
+
+// DeleteWithContext is Delete with a Context for the request
+func (s *ProxiesServiceOp) DeleteWithContext(ctx context.Context, proxyName string) (*DeletedProxyInfo, *Response, error) {
+	urlPath := path.Join(proxiesPath, proxyName)
+	req, e := s.client.NewRequestNoEnvWithContext(ctx, "DELETE", urlPath, nil)
+	if e != nil {
+		return nil, nil, e
+	}
+	proxy := DeletedProxyInfo{}
+	resp, e := s.client.Do(req, &proxy)
+	if e != nil {
+		return nil, resp, e
+	}
+	return &proxy, resp, e
+}
 
 // GetDeployment retrieves the information about the deployment of an API Proxy in an environment.
 // DOES NOT WORK WITH GCP API!
 func (s *ProxiesServiceOp) GetDeployment(proxy string) (*EnvironmentDeployment, *Response, error) {
+	return s.GetDeploymentWithContext(context.Background(), proxy)
+}
+
+// GetDeploymentWithContext is GetDeployment with a Context for the request
+func (s *ProxiesServiceOp) GetDeploymentWithContext(ctx context.Context, proxy string) (*EnvironmentDeployment, *Response, error) {
 	if s.client.IsGCPManaged {
 		return nil, nil, errors.New("not compatible with GCP Experience")
 	}
 	urlPath := path.Join(proxiesPath, proxy, "deployments")
-	req, e := s.client.NewRequest("GET", urlPath, nil)
+	req, e := s.client.NewRequestWithContext(ctx, "GET", urlPath, nil)
 	if e != nil {
 		return nil, nil, e
 	}
@@ -515,8 +563,13 @@ func (s *ProxiesServiceOp) GetDeployment(proxy string) (*EnvironmentDeployment,
 
 // GetDeployedRevision returns the Revision that is deployed to an environment.
 func (s *ProxiesServiceOp) GetDeployedRevision(proxy string) (*Revision, error) {
-	deployment, resp, err := s.GetDeployment(proxy)
-	if err != nil && (resp == nil || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+	return s.GetDeployedRevisionWithContext(context.Background(), proxy)
+}
+
+// GetDeployedRevisionWithContext is GetDeployedRevision with a Context for the request
+func (s *ProxiesServiceOp) GetDeployedRevisionWithContext(ctx context.Context, proxy string) (*Revision, error) {
+	deployment, resp, err := s.GetDeploymentWithContext(ctx, proxy)
+	if err != nil && (resp == nil || errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden)) {
 		return nil, err
 	}
 	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
@@ -534,11 +587,16 @@ func (s *ProxiesServiceOp) GetDeployedRevision(proxy string) (*Revision, error)
 // GetGCPDeployments retrieves the information about deployments of an API Proxy in
 // an GCP organization, including the environment names and revision numbers.
 func (s *ProxiesServiceOp) GetGCPDeployments(proxy string) ([]GCPDeployment, *Response, error) {
+	return s.GetGCPDeploymentsWithContext(context.Background(), proxy)
+}
+
+// GetGCPDeploymentsWithContext is GetGCPDeployments with a Context for the request
+func (s *ProxiesServiceOp) GetGCPDeploymentsWithContext(ctx context.Context, proxy string) ([]GCPDeployment, *Response, error) {
 	if !s.client.IsGCPManaged {
 		return nil, nil, errors.New("only compatible with GCP Experience")
 	}
 	urlPath := path.Join(proxiesPath, proxy, "deployments")
-	req, e := s.client.NewRequest("GET", urlPath, nil)
+	req, e := s.client.NewRequestWithContext(ctx, "GET", urlPath, nil)
 	if e != nil {
 		return nil, nil, e
 	}
@@ -552,8 +610,13 @@ func (s *ProxiesServiceOp) GetGCPDeployments(proxy string) ([]GCPDeployment, *Re
 
 // GetGCPDeployedRevision returns the Revision that is deployed to an environment in GCP.
 func (s *ProxiesServiceOp) GetGCPDeployedRevision(proxy string) (*Revision, error) {
-	deployments, resp, err := s.GetGCPDeployments(proxy)
-	if err != nil && (resp == nil || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+	return s.GetGCPDeployedRevisionWithContext(context.Background(), proxy)
+}
+
+// GetGCPDeployedRevisionWithContext is GetGCPDeployedRevision with a Context for the request
+func (s *ProxiesServiceOp) GetGCPDeployedRevisionWithContext(ctx context.Context, proxy string) (*Revision, error) {
+	deployments, resp, err := s.GetGCPDeploymentsWithContext(ctx, proxy)
+	if err != nil && (resp == nil || errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden)) {
 		return nil, err
 	}
 	if len(deployments) > 0 {
@@ -567,3 +630,50 @@ func (s *ProxiesServiceOp) GetGCPDeployedRevision(proxy string) (*Revision, erro
 
 	return nil, nil
 }
+
+// GetDeployedEnvironments returns the environments of the organization that
+// the API Proxy is deployed to.
+func (s *ProxiesServiceOp) GetDeployedEnvironments(proxy string) ([]string, error) {
+	return s.GetDeployedEnvironmentsWithContext(context.Background(), proxy)
+}
+
+// GetDeployedEnvironmentsWithContext is GetDeployedEnvironments with a Context for the request
+func (s *ProxiesServiceOp) GetDeployedEnvironmentsWithContext(ctx context.Context, proxy string) ([]string, error) {
+	urlPath := path.Join(proxiesPath, proxy, "deployments")
+	req, e := s.client.NewRequestNoEnvWithContext(ctx, "GET", urlPath, nil)
+	if e != nil {
+		return nil, e
+	}
+
+	var envs []string
+	if s.client.IsGCPManaged {
+		deployments := GCPDeployments{}
+		if _, e = s.client.Do(req, &deployments); e != nil {
+			if errors.Is(e, ErrNotFound) {
+				return nil, nil
+			}
+			return nil, e
+		}
+		for _, d := range deployments.Deployments {
+			envs = append(envs, d.Environment)
+		}
+		return envs, nil
+	}
+
+	deployment := ProxyDeployment{}
+	if _, e = s.client.Do(req, &deployment); e != nil {
+		if errors.Is(e, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, e
+	}
+	for _, env := range deployment.Environments {
+		for _, rev := range env.Revision {
+			if rev.State == "deployed" {
+				envs = append(envs, env.Name)
+				break
+			}
+		}
+	}
+	return envs, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetDeployedEnvironments(t *testing.T) {
+	tests := []struct {
+		gcp  bool
+		body string
+		want []string
+	}{
+		{false, `{"name": "proxy", "environment": [` +
+			`{"name": "env1", "revision": [{"name": "1", "state": "deployed"}]}, ` +
+			`{"name": "env2", "revision": [{"name": "2", "state": "undeployed"}]}, ` +
+			`{"name": "env3", "revision": [{"name": "1", "state": "undeployed"}, {"name": "2", "state": "deployed"}]}]}`,
+			[]string{"env1", "env3"}},
+		{true, `{"deployments": [{"environment": "env1", "apiProxy": "proxy", "revision": "1"}, ` +
+			`{"environment": "env2", "apiProxy": "proxy", "revision": "2"}]}`,
+			[]string{"env1", "env2"}},
+		{true, `{}`, nil},
+		{false, ``, nil},
+	}
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/organizations/org/apis/proxy/deployments" {
+				t.Errorf("unexpected request: %s", r.URL)
+			}
+			if test.body == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(test.body))
+		}))
+
+		client := newTestClient(t, ts.URL, EdgeClientOptions{GCPManaged: test.gcp})
+		envs, err := client.Proxies.GetDeployedEnvironments("proxy")
+		ts.Close()
+		if err != nil {
+			t.Errorf("%s want no error: %v", test.body, err)
+		}
+		if !reflect.DeepEqual(test.want, envs) {
+			t.Errorf("%s want %v, got: %v", test.body, test.want, envs)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"regexp"
+)
+
+const redacted = "REDACTED"
+
+var (
+	// header lines that carry credentials, keeping the auth scheme
+	authHeaderPattern = regexp.MustCompile(`(?im)^((?:Proxy-)?Authorization:[ \t]*(?:\w+[ \t]+)?)\S.*?(\r?)$`)
+
+	// cookie header lines
+	cookieHeaderPattern = regexp.MustCompile(`(?im)^((?:Set-)?Cookie:[ \t]*)\S.*?(\r?)$`)
+
+	// JSON string fields that hold secrets
+	secretFieldPattern = regexp.MustCompile(`("(?:secret|client_secret|private_key|consumerSecret|password|access_token|refresh_token)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+	// PEM blocks, either raw or JSON-escaped
+	pemPattern = regexp.MustCompile(`-----BEGIN ([A-Z0-9 ]+)-----[\s\S]*?-----END [A-Z0-9 ]+-----`)
+)
+
+// redact masks credentials, secret JSON fields and PEM blocks in an HTTP dump
+func redact(data []byte) []byte {
+	data = authHeaderPattern.ReplaceAll(data, []byte("${1}"+redacted+"${2}"))
+	data = cookieHeaderPattern.ReplaceAll(data, []byte("${1}"+redacted+"${2}"))
+	data = secretFieldPattern.ReplaceAll(data, []byte(`${1}"`+redacted+`"`))
+	data = pemPattern.ReplaceAll(data, []byte("-----BEGIN ${1}----- "+redacted+" -----END ${1}-----"))
+	return data
+}
+
+// redactHeader masks the value of a header that carries credentials
+func redactHeader(name, value string) string {
+	line := name + ": " + value
+	return string(redact([]byte(line)))[len(name)+2:]
+}
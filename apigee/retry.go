@@ -0,0 +1,171 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMinBackoff is the default delay before the first retry
+	DefaultMinBackoff = time.Second
+
+	// DefaultMaxBackoff is the default maximum delay between retries
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// RetryPolicy controls how requests that fail with transient errors are
+// retried. Only requests with idempotent methods, or requests marked with
+// MarkRetryable, are retried. The zero value disables retries.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+
+	// MinBackoff is the delay before the first retry. It doubles for each
+	// subsequent retry. Defaults to DefaultMinBackoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between retries, including any
+	// Retry-After requested by the server. Defaults to DefaultMaxBackoff.
+	MaxBackoff time.Duration
+}
+
+type retryableKey struct{}
+
+// MarkRetryable returns a copy of req that may be retried regardless of its
+// method. Use this for requests, such as updates that replace a resource's
+// state, that are safe to repeat. Don't mark creates: if a create succeeds
+// but its response is lost, the retry fails with a conflict that can't be
+// told apart from a resource that already existed.
+func MarkRetryable(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), retryableKey{}, true))
+}
+
+// canRetry returns true if the request may be sent again
+func (p RetryPolicy) canRetry(req *http.Request) bool {
+	if p.MaxRetries <= 0 {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false // body can't be rewound
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	marked, _ := req.Context().Value(retryableKey{}).(bool)
+	return marked
+}
+
+// shouldRetry returns true if the result of a request is a transient failure
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil // connection error, but not cancelled
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before the retry following the given attempt,
+// which starts at 0
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	min, max := p.MinBackoff, p.MaxBackoff
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	if after, ok := retryAfter(resp); ok {
+		if after > max {
+			return max
+		}
+		return after
+	}
+
+	delay := min << uint(attempt)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	// jitter in the range [delay/2, delay)
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retryAfter parses the Retry-After header as seconds or an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// rewind prepares the request to be sent again
+func rewind(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
+// discard drains and closes a response that will not be returned
+func discard(resp *http.Response) {
+	if resp != nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
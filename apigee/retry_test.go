@@ -0,0 +1,201 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// unavailableServer fails every odd request with 503 and records the bodies
+// of the requests
+func unavailableServer(bodies *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		*bodies = append(*bodies, string(body))
+		if len(*bodies)%2 == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+}
+
+func TestRetry(t *testing.T) {
+	var bodies []string
+	ts := unavailableServer(&bodies)
+	defer ts.Close()
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Retry: RetryPolicy{MaxRetries: 3}})
+	req, err := client.NewRequest(http.MethodPut, "apiproducts/product", map[string]string{"name": "product"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req, nil); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	if len(bodies) != 2 || bodies[0] != bodies[1] {
+		t.Errorf("want request sent twice with the same body, got: %q", bodies)
+	}
+}
+
+func TestRetryDisabled(t *testing.T) {
+	var bodies []string
+	ts := unavailableServer(&bodies)
+	defer ts.Close()
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{})
+	req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errResp *ErrorResponse
+	if _, err := client.Do(req, nil); !errors.As(err, &errResp) || errResp.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("want 503 error, got: %v", err)
+	}
+	if len(bodies) != 1 {
+		t.Errorf("want 1 request, got: %d", len(bodies))
+	}
+}
+
+func TestRetryPost(t *testing.T) {
+	var bodies []string
+	ts := unavailableServer(&bodies)
+	defer ts.Close()
+
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Retry: RetryPolicy{MaxRetries: 3}})
+
+	// not idempotent, not retried
+	req, err := client.NewRequest(http.MethodPost, "apiproducts", map[string]string{"name": "product"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req, nil); err == nil {
+		t.Errorf("want 503 error, got none")
+	}
+	if len(bodies) != 1 {
+		t.Errorf("want 1 request, got: %d", len(bodies))
+	}
+
+	// marked as safe to repeat
+	bodies = nil
+	req, err = client.NewRequest(http.MethodPost, "apiproducts", map[string]string{"name": "product"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(MarkRetryable(req), nil); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Errorf("want 2 requests, got: %d", len(bodies))
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		if delay := policy.backoff(attempt, nil); delay < max/2 || delay > max {
+			t.Errorf("attempt %d want delay in [%v, %v], got: %v", attempt, max/2, max, delay)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Retry-After", "0")
+	if delay := policy.backoff(0, resp); delay != 0 {
+		t.Errorf("want Retry-After delay 0, got: %v", delay)
+	}
+	resp.Header.Set("Retry-After", "120")
+	if delay := policy.backoff(0, resp); delay != time.Second {
+		t.Errorf("want Retry-After limited to %v, got: %v", time.Second, delay)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	tests := []struct {
+		status int
+		err    error
+		want   bool
+	}{
+		{http.StatusTooManyRequests, nil, true},
+		{http.StatusBadGateway, nil, true},
+		{http.StatusServiceUnavailable, nil, true},
+		{http.StatusNotFound, nil, false},
+		{http.StatusConflict, nil, false},
+		{0, errors.New("connection refused"), true},
+	}
+	for _, test := range tests {
+		var resp *http.Response
+		if test.err == nil {
+			resp = &http.Response{StatusCode: test.status}
+		}
+		if got := shouldRetry(req, resp, test.err); got != test.want {
+			t.Errorf("%d %v want %t, got: %t", test.status, test.err, test.want, got)
+		}
+	}
+}
+
+func TestRetryCreate(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// a retried create that had succeeded would conflict with itself
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Retry: RetryPolicy{MaxRetries: 3}})
+	if _, err := client.KVMService.Create(KVM{Name: "kvm"}); err == nil {
+		t.Errorf("want 503 error, got none")
+	}
+	if _, err := client.CacheService.Create(Cache{Name: "cache"}); err == nil {
+		t.Errorf("want 503 error, got none")
+	}
+	if requests != 2 {
+		t.Errorf("want each create sent once, got: %d requests", requests)
+	}
+}
+
+func TestRetryNotIdempotent(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// a retried deployment, undeployment or entry update that had succeeded
+	// would fail
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Retry: RetryPolicy{MaxRetries: 3}})
+	if _, _, err := client.Proxies.Deploy("proxy", "env", 1); err == nil {
+		t.Errorf("want 503 error, got none")
+	}
+	if _, _, err := client.Proxies.Undeploy("proxy", "env", 1); err == nil {
+		t.Errorf("want 503 error, got none")
+	}
+	if _, err := client.KVMService.UpdateEntry("kvm", Entry{Name: "entry"}); err == nil {
+		t.Errorf("want 503 error, got none")
+	}
+	if requests != 3 {
+		t.Errorf("want each request sent once, got: %d requests", requests)
+	}
+}
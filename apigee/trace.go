@@ -0,0 +1,287 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const harVersion = "1.2"
+
+// Tracer records the requests and responses of an EdgeClient so that they
+// can be exported as a HAR (HTTP Archive) file. Headers and bodies are
+// redacted as in Debug output unless Unsafe is set. A Tracer may be shared
+// by multiple clients.
+type Tracer struct {
+	// Optional. If true, credentials and secrets are recorded.
+	Unsafe bool
+
+	creator harCreator
+
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// NewTracer returns a Tracer that identifies its HAR output as created by
+// the named program and version
+func NewTracer(name, version string) *Tracer {
+	return &Tracer{creator: harCreator{Name: name, Version: version}}
+}
+
+type harLog struct {
+	Log harLogBody `json:"log"`
+}
+
+type harLogBody struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type requestStartKey struct{}
+
+// withStartTime returns a copy of req that records when it was sent
+func withStartTime(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), requestStartKey{}, time.Now()))
+}
+
+// record is a RequestCompletionCallback that adds a completed request to the trace.
+// The response body is read and replaced so that it may still be consumed.
+func (t *Tracer) record(req *http.Request, resp *http.Response) {
+	entry := t.newEntry(req)
+
+	var body []byte
+	if resp.Body != nil {
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     t.headers(resp.Header),
+		Content: harContent{
+			Size:     int64(len(body)),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     t.text(body),
+		},
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+
+	t.add(entry)
+}
+
+// recordError adds a request that failed without a response to the trace
+func (t *Tracer) recordError(req *http.Request, err error) {
+	entry := t.newEntry(req)
+	entry.Response = harResponse{
+		Cookies:     []harNameValue{},
+		Headers:     []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	entry.Error = err.Error()
+	t.add(entry)
+}
+
+func (t *Tracer) newEntry(req *http.Request) harEntry {
+	now := time.Now()
+	started, ok := req.Context().Value(requestStartKey{}).(time.Time)
+	if !ok {
+		started = now
+	}
+	elapsed := float64(now.Sub(started)) / float64(time.Millisecond)
+
+	query := []harNameValue{}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			query = append(query, harNameValue{Name: name, Value: v})
+		}
+	}
+
+	request := harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     t.headers(req.Header),
+		QueryString: query,
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		request.BodySize = 0
+	} else if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			body, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			request.BodySize = int64(len(body))
+			request.PostData = &harPostData{
+				MimeType: req.Header.Get("Content-Type"),
+				Text:     t.text(body),
+			}
+		}
+	}
+
+	return harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            elapsed,
+		Request:         request,
+		Timings:         harTimings{Wait: elapsed},
+	}
+}
+
+func (t *Tracer) add(entry harEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entry)
+}
+
+func (t *Tracer) headers(h http.Header) []harNameValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := []harNameValue{}
+	for _, name := range names {
+		for _, v := range h[name] {
+			if !t.Unsafe {
+				v = redactHeader(name, v)
+			}
+			headers = append(headers, harNameValue{Name: name, Value: v})
+		}
+	}
+	return headers
+}
+
+// text returns a body as text, or empty if it is binary
+func (t *Tracer) text(body []byte) string {
+	if !utf8.Valid(body) {
+		return ""
+	}
+	if !t.Unsafe {
+		body = redact(body)
+	}
+	return string(body)
+}
+
+// WriteHAR writes the recorded requests as a HAR document
+func (t *Tracer) WriteHAR(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := t.entries
+	if entries == nil {
+		entries = []harEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(harLog{
+		Log: harLogBody{
+			Version: harVersion,
+			Creator: t.creator,
+			Entries: entries,
+		},
+	})
+}
+
+// WriteHARFile writes the recorded requests as a HAR file, readable only by the user
+func (t *Tracer) WriteHARFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := t.WriteHAR(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
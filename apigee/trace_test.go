@@ -0,0 +1,150 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigee
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readHAR reads the HAR file written by tracer
+func readHAR(t *testing.T, tracer *Tracer) harLogBody {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "trace.har")
+	if err := tracer.WriteHARFile(file); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("want trace readable only by the user, got: %v, %v", info.Mode(), err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("invalid HAR: %v", err)
+	}
+	return har.Log
+}
+
+// header returns the value of the named header of a HAR entry
+func header(headers []harNameValue, name string) string {
+	for _, h := range headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func TestTracer(t *testing.T) {
+	var bodies []string
+	ts := unavailableServer(&bodies)
+	defer ts.Close()
+
+	tracer := NewTracer("test", "1.0")
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Tracer: tracer, Retry: RetryPolicy{MaxRetries: 3}})
+	req, err := client.NewRequest(http.MethodPut, "credential", map[string]string{"key": "/key/", "secret": "/secret/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req, nil); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	har := readHAR(t, tracer)
+	if har.Version != "1.2" || har.Creator.Name != "test" || har.Creator.Version != "1.0" {
+		t.Errorf("unexpected HAR log: %s %#v", har.Version, har.Creator)
+	}
+
+	// each attempt of a retried request is recorded
+	if len(har.Entries) != 2 {
+		t.Fatalf("want 2 entries, got: %d", len(har.Entries))
+	}
+	for i, wantStatus := range []int{http.StatusServiceUnavailable, http.StatusOK} {
+		entry := har.Entries[i]
+		if entry.Response.Status != wantStatus {
+			t.Errorf("entry %d want status %d, got: %d", i, wantStatus, entry.Response.Status)
+		}
+		if entry.Request.Method != http.MethodPut || !strings.HasPrefix(entry.Request.URL, ts.URL) {
+			t.Errorf("entry %d unexpected request: %s %s", i, entry.Request.Method, entry.Request.URL)
+		}
+		if auth := header(entry.Request.Headers, "Authorization"); auth != "Basic REDACTED" {
+			t.Errorf("entry %d want redacted Authorization, got: %s", i, auth)
+		}
+		if entry.Request.PostData == nil || entry.Request.PostData.Text != `{"key":"/key/","secret":"REDACTED"}`+"\n" {
+			t.Errorf("entry %d want redacted request body, got: %#v", i, entry.Request.PostData)
+		}
+	}
+	if har.Entries[1].Response.Content.Text != "{}" {
+		t.Errorf("want response body recorded, got: %s", har.Entries[1].Response.Content.Text)
+	}
+}
+
+func TestTracerUnsafe(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	tracer := NewTracer("test", "1.0")
+	tracer.Unsafe = true
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Tracer: tracer})
+	req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req, nil); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	har := readHAR(t, tracer)
+	if len(har.Entries) != 1 {
+		t.Fatalf("want 1 entry, got: %d", len(har.Entries))
+	}
+	if auth := header(har.Entries[0].Request.Headers, "Authorization"); auth != "Basic L3VzZXJuYW1lLzpwYXNzd29yZA==" {
+		t.Errorf("want Authorization with Unsafe, got: %s", auth)
+	}
+}
+
+func TestTracerError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close() // refuse connections
+
+	tracer := NewTracer("test", "1.0")
+	client := newTestClient(t, ts.URL, EdgeClientOptions{Tracer: tracer})
+	req, err := client.NewRequest(http.MethodGet, "apiproducts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req, nil); err == nil {
+		t.Fatalf("want connection error, got none")
+	}
+
+	har := readHAR(t, tracer)
+	if len(har.Entries) != 1 || har.Entries[0].Error == "" || har.Entries[0].Response.Status != 0 {
+		t.Errorf("want failed request recorded with its error, got: %#v", har.Entries)
+	}
+}
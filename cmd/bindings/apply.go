@@ -0,0 +1,227 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-golib/product"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
+)
+
+// manifest is the desired state of Product to Remote Target bindings, eg:
+//
+//	products:
+//	- name: my-product
+//	  targets:
+//	  - my-target.default.svc.cluster.local
+type manifest struct {
+	Products []manifestProduct `yaml:"products"`
+}
+
+type manifestProduct struct {
+	Name    string   `yaml:"name"`
+	Targets []string `yaml:"targets"`
+}
+
+// bindingChange is the set of target changes planned for a single product
+type bindingChange struct {
+	product *product.APIProduct
+	add     []string
+	remove  []string
+	targets []string // resulting bindings
+}
+
+func cmdBindingsApply(b *bindings, printf shared.FormatFn) *cobra.Command {
+	var file string
+	var dryRun, prune bool
+
+	c := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply Remote Target bindings from a manifest file",
+		Long: `Apply Remote Target bindings from a manifest file. The manifest lists the desired targets
+for each Apigee Product. By default, targets are only added. With --prune, bound targets
+that are not listed in the manifest are removed, including from Products not in the manifest.
+
+Example manifest:
+
+products:
+- name: my-product
+  targets:
+  - my-target.default.svc.cluster.local`,
+		Args: cobra.NoArgs,
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			m, err := readManifest(file)
+			if err != nil {
+				return err
+			}
+			if prune && len(m.Products) == 0 {
+				return fmt.Errorf("--prune requires a manifest that lists products, %s lists none", file)
+			}
+			changes, err := b.planBindings(m, prune)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+			printPlan(changes, printf)
+			if dryRun || len(changes) == 0 {
+				return nil
+			}
+			return b.applyBindings(changes, printf)
+		},
+	}
+
+	c.Flags().StringVarP(&file, "file", "f", "", "bindings manifest file")
+	c.Flags().BoolVarP(&dryRun, "dry-run", "", false, "print planned changes without applying them")
+	c.Flags().BoolVarP(&prune, "prune", "", false, "remove bound targets not listed in the manifest")
+
+	c.MarkFlagRequired("file")
+
+	return c
+}
+
+// readManifest reads and decodes file. Unknown fields are rejected, so that
+// a misspelled key isn't mistaken for a product without targets.
+func readManifest(file string) (*manifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading manifest %s", file)
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	m := &manifest{}
+	if err := decoder.Decode(m); err != nil && err != io.EOF { // EOF is an empty manifest
+		return nil, errors.Wrapf(err, "parsing manifest %s", file)
+	}
+	return m, nil
+}
+
+// planBindings computes the changes required to move the current bindings to the manifest
+func (b *bindings) planBindings(m *manifest, prune bool) ([]bindingChange, error) {
+	products, err := b.getProducts()
+	if err != nil {
+		return nil, err
+	}
+	byProductName := make(map[string]*product.APIProduct, len(products))
+	for i := range products {
+		byProductName[products[i].Name] = &products[i]
+	}
+
+	desired := make(map[string][]string, len(m.Products))
+	for _, mp := range m.Products {
+		if _, ok := byProductName[mp.Name]; !ok {
+			return nil, fmt.Errorf("invalid product name: %s", mp.Name)
+		}
+		if _, ok := desired[mp.Name]; ok {
+			return nil, fmt.Errorf("duplicate product in manifest: %s", mp.Name)
+		}
+		var targets []string
+		for _, t := range mp.Targets {
+			if t = strings.TrimSpace(t); t != "" {
+				if _, ok := indexOf(targets, t); !ok {
+					targets = append(targets, t)
+				}
+			}
+		}
+		desired[mp.Name] = targets
+	}
+
+	var changes []bindingChange
+	for i := range products {
+		p := &products[i]
+		want, listed := desired[p.Name]
+		if !listed && !prune {
+			continue
+		}
+		bound := boundTargets(p)
+		change := bindingChange{product: p}
+		for _, t := range want {
+			if _, ok := indexOf(bound, t); !ok {
+				change.add = append(change.add, t)
+			}
+		}
+		for _, t := range bound {
+			if _, ok := indexOf(want, t); ok {
+				change.targets = append(change.targets, t)
+			} else if prune {
+				change.remove = append(change.remove, t)
+			} else {
+				change.targets = append(change.targets, t)
+			}
+		}
+		if len(change.add) == 0 && len(change.remove) == 0 {
+			continue
+		}
+		change.targets = append(change.targets, change.add...)
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].product.Name < changes[j].product.Name })
+
+	return changes, nil
+}
+
+func printPlan(changes []bindingChange, printf shared.FormatFn) {
+	if len(changes) == 0 {
+		printf("bindings are up to date, no changes")
+		return
+	}
+	printf("planned changes:")
+	for _, c := range changes {
+		printf("%s:", c.product.Name)
+		for _, t := range c.add {
+			printf("  + %s", t)
+		}
+		for _, t := range c.remove {
+			printf("  - %s", t)
+		}
+	}
+}
+
+func (b *bindings) applyBindings(changes []bindingChange, printf shared.FormatFn) error {
+	var errs error
+	for _, c := range changes {
+		if err := b.updateTargetBindings(c.product, c.targets); err != nil {
+			errs = multierr.Append(errs, errors.Wrapf(err, "updating bindings for %s", c.product.Name))
+			continue
+		}
+		if len(c.targets) == 0 {
+			printf("product %s is no longer bound to any target", c.product.Name)
+		} else {
+			printf("product %s is now bound to: %s", c.product.Name, strings.Join(c.targets, ","))
+		}
+	}
+	return errs
+}
+
+// boundTargets returns the targets bound to the product, ignoring empty values
+func boundTargets(p *product.APIProduct) []string {
+	var targets []string
+	for _, t := range p.GetBoundTargets() {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
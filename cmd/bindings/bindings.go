@@ -15,26 +15,42 @@
 package bindings
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/cmd/products"
 	"github.com/apigee/apigee-remote-service-cli/shared"
 	"github.com/apigee/apigee-remote-service-golib/product"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 const (
 	productsURLFormat     = "/v1/organizations/%s/apiproducts"               // ManagementBase
+	productPathFormat     = "/v1/organizations/%s/apiproducts/%s"            // ManagementBase, prod
 	productAttrPathFormat = "/v1/organizations/%s/apiproducts/%s/attributes" // ManagementBase, prod
+
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
 )
 
 type bindings struct {
 	*shared.RootArgs
 	products []product.APIProduct
+	output   string
+	target   string
+	noMerge  bool
 }
 
 // Cmd returns base command
@@ -56,14 +72,23 @@ func Cmd(rootArgs *shared.RootArgs, printf shared.FormatFn) *cobra.Command {
 		"Apigee opdk")
 	c.PersistentFlags().StringVarP(&rootArgs.Token, "token", "t", "",
 		"Apigee OAuth or SAML token (hybrid only)")
+	c.PersistentFlags().StringVarP(&rootArgs.ServiceAccount, "service-account", "", "",
+		"Google service account key file for OAuth tokens (hybrid only)")
+	c.PersistentFlags().BoolVarP(&rootArgs.UseADC, "adc", "", false,
+		"use Google Application Default Credentials for OAuth tokens (hybrid only)")
 	c.PersistentFlags().StringVarP(&rootArgs.Username, "username", "u", "",
 		"Apigee username (legacy or OPDK only)")
 	c.PersistentFlags().StringVarP(&rootArgs.Password, "password", "p", "",
 		"Apigee password (legacy or OPDK only)")
+	c.PersistentFlags().BoolVarP(&cfg.noMerge, "no-merge", "", false,
+		"fail instead of merging if a product was modified since it was read")
 
 	c.AddCommand(cmdBindingsList(cfg, printf))
 	c.AddCommand(cmdBindingsAdd(cfg, printf))
 	c.AddCommand(cmdBindingsRemove(cfg, printf))
+	c.AddCommand(cmdBindingsApply(cfg, printf))
+	c.AddCommand(cmdBindingsVerify(cfg, printf))
+	c.AddCommand(cmdBindingsTargets(cfg, printf))
 
 	return c
 }
@@ -75,23 +100,44 @@ func cmdBindingsList(b *bindings, printf shared.FormatFn) *cobra.Command {
 		Long:  "List Apigee Product to Remote Target bindings",
 		Args:  cobra.NoArgs,
 
-		Run: func(cmd *cobra.Command, _ []string) {
-			b.cmdList(printf)
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return b.cmdList(printf)
 		},
 	}
 
+	c.Flags().StringVarP(&b.output, "output", "", outputTable,
+		"output format: table, json, or yaml")
+	c.Flags().StringVarP(&b.target, "target", "", "",
+		"only list products bound to the specified target")
+
 	return c
 }
 
 func cmdBindingsAdd(b *bindings, printf shared.FormatFn) *cobra.Command {
+	var allProducts, createProduct bool
+	var productOpts products.Options
+
 	c := &cobra.Command{
-		Use:   "add [target name] [product name]",
-		Short: "Add Remote Target binding to Apigee Product",
-		Long:  "Add Remote Target binding to Apigee Product",
-		Args:  cobra.ExactArgs(2),
+		Use:   "add [target name] [product name]...",
+		Short: "Add Remote Target binding to Apigee Products",
+		Long: `Add Remote Target binding to Apigee Products. Product names may be glob patterns
+(eg. "team-*") and multiple products may be listed. Use --all-products to bind to every product. Use --create-product to create any listed
+products that do not exist.`,
+		Args: productArgs(&allProducts),
 
 		RunE: func(cmd *cobra.Command, args []string) error {
 			targetName := args[0]
+			if createProduct && !allProducts {
+				if err := b.createMissingProducts(args[1:], productOpts, printf); err != nil {
+					cmd.SilenceUsage = true
+					return err
+				}
+			}
+			if isBulk(args[1:], allProducts) {
+				cmd.SilenceUsage = true
+				return b.bulkUpdate(targetName, args[1:], allProducts, b.bindTarget, printf)
+			}
+
 			productName := args[1]
 			p, err := b.getProduct(productName)
 			if err != nil {
@@ -110,18 +156,31 @@ func cmdBindingsAdd(b *bindings, printf shared.FormatFn) *cobra.Command {
 		},
 	}
 
+	c.Flags().BoolVarP(&allProducts, "all-products", "", false, "bind target to all products")
+	c.Flags().BoolVarP(&createProduct, "create-product", "", false,
+		"create products that do not exist using the product flags")
+	productOpts.AddFlags(c.Flags())
+
 	return c
 }
 
 func cmdBindingsRemove(b *bindings, printf shared.FormatFn) *cobra.Command {
+	var allProducts bool
+
 	c := &cobra.Command{
-		Use:   "remove [target name] [product name]",
-		Short: "Remove target binding from Apigee Product",
-		Long:  "Remove target binding from Apigee Product",
-		Args:  cobra.ExactArgs(2),
+		Use:   "remove [target name] [product name]...",
+		Short: "Remove target binding from Apigee Products",
+		Long: `Remove target binding from Apigee Products. Product names may be glob patterns
+(eg. "team-*") and multiple products may be listed. Use --all-products to unbind from every product.`,
+		Args: productArgs(&allProducts),
 
 		RunE: func(cmd *cobra.Command, args []string) error {
 			targetName := args[0]
+			if isBulk(args[1:], allProducts) {
+				cmd.SilenceUsage = true
+				return b.bulkUpdate(targetName, args[1:], allProducts, b.unbindTarget, printf)
+			}
+
 			productName := args[1]
 			p, err := b.getProduct(productName)
 			if err != nil {
@@ -136,41 +195,268 @@ func cmdBindingsRemove(b *bindings, printf shared.FormatFn) *cobra.Command {
 		},
 	}
 
+	c.Flags().BoolVarP(&allProducts, "all-products", "", false, "remove target from all products")
+
 	return c
 }
 
+// productArgs requires a target and either product names or --all-products
+func productArgs(allProducts *bool) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if *allProducts {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	}
+}
+
+// isBulk returns false if the args are a single literal product name
+func isBulk(productNames []string, allProducts bool) bool {
+	return allProducts || len(productNames) != 1 || isPattern(productNames[0])
+}
+
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+type targetUpdateFn func(p *product.APIProduct, target string, printf shared.FormatFn) error
+
+// bulkUpdate applies update to all matching products and prints a summary
+func (b *bindings) bulkUpdate(target string, productNames []string, allProducts bool,
+	update targetUpdateFn, printf shared.FormatFn) error {
+
+	matched, invalid, err := b.matchProducts(productNames, allProducts)
+	if err != nil {
+		return err
+	}
+
+	failures := make(map[string]error)
+	for _, name := range invalid {
+		failures[name] = errors.New("invalid product name")
+	}
+	succeeded := 0
+	for _, p := range matched {
+		if err := update(p, target, printf); err != nil {
+			failures[p.Name] = err
+			continue
+		}
+		succeeded++
+	}
+
+	printf("target %s: %d product(s) succeeded, %d failed", target, succeeded, len(failures))
+	if len(failures) == 0 {
+		return nil
+	}
+	var names []string
+	for name := range failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		printf("  %s: %v", name, failures[name])
+	}
+	return fmt.Errorf("failed to update %d product(s)", len(failures))
+}
+
+// matchProducts returns the products matching the names or glob patterns, and
+// the names that did not match any product
+func (b *bindings) matchProducts(names []string, allProducts bool) (matched []*product.APIProduct, invalid []string, err error) {
+	products, err := b.getProducts()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]bool)
+	add := func(p *product.APIProduct) {
+		if !seen[p.Name] {
+			seen[p.Name] = true
+			matched = append(matched, p)
+		}
+	}
+
+	if allProducts {
+		for i := range products {
+			add(&products[i])
+		}
+		return matched, nil, nil
+	}
+
+	for _, name := range names {
+		found := false
+		for i := range products {
+			ok := products[i].Name == name
+			if !ok && isPattern(name) {
+				if ok, err = path.Match(name, products[i].Name); err != nil {
+					return nil, nil, errors.Wrapf(err, "invalid product pattern %s", name)
+				}
+			}
+			if ok {
+				found = true
+				add(&products[i])
+			}
+		}
+		if !found {
+			invalid = append(invalid, name)
+		}
+	}
+	return matched, invalid, nil
+}
+
+// createMissingProducts creates the literal product names that do not exist
+// and adds them to the products cache
+func (b *bindings) createMissingProducts(names []string, opts products.Options, printf shared.FormatFn) error {
+	for _, name := range names {
+		if isPattern(name) {
+			continue
+		}
+		p, err := b.getProduct(name)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			continue
+		}
+		created, _, err := b.Client.Products.CreateWithContext(b.Context(), opts.NewProduct(name, b.Env))
+		if err != nil {
+			return errors.Wrapf(err, "creating product %s", name)
+		}
+		b.products = append(b.products, toAPIProduct(created))
+		printf("product %s created", name)
+	}
+	return nil
+}
+
+// toAPIProduct converts a created Product to the form used for bindings
+func toAPIProduct(p *apigee.Product) product.APIProduct {
+	ap := product.APIProduct{
+		Name:          p.Name,
+		DisplayName:   p.DisplayName,
+		Description:   p.Description,
+		Environments:  p.Environments,
+		Resources:     p.APIResources,
+		Scopes:        p.Scopes,
+		QuotaLimit:    p.Quota,
+		QuotaInterval: p.QuotaInterval,
+		QuotaTimeUnit: p.QuotaTimeUnit,
+	}
+	for _, a := range p.Attributes {
+		ap.Attributes = append(ap.Attributes, product.Attribute{Name: a.Name, Value: a.Value})
+	}
+	return ap
+}
+
 func (b *bindings) getProduct(name string) (*product.APIProduct, error) {
 	products, err := b.getProducts()
 	if err != nil {
 		return nil, err
 	}
-	for _, p := range products {
-		if p.Name == name {
-			return &p, nil
+	for i := range products {
+		if products[i].Name == name {
+			return &products[i], nil
 		}
 	}
 	return nil, nil
 }
 
+// productsPageSize is the number of products requested per page
+var productsPageSize = 1000
+
+// productsPage is a page of products. NextPageToken is only set by GCP.
+type productsPage struct {
+	APIProducts   []product.APIProduct `json:"apiProduct"`
+	NextPageToken string               `json:"nextPageToken,omitempty"`
+}
+
 func (b *bindings) getProducts() ([]product.APIProduct, error) {
 	if b.products != nil {
 		return b.products, nil
 	}
-	req, err := b.Client.NewRequest(http.MethodGet, "", nil)
+
+	var products []product.APIProduct
+	var startKey, pageToken string
+	for {
+		page, err := b.getProductsPage(startKey, pageToken)
+		if err != nil {
+			return nil, err
+		}
+
+		if b.IsGCPManaged {
+			products = append(products, page.APIProducts...)
+			if page.NextPageToken == "" {
+				break
+			}
+			pageToken = page.NextPageToken
+			continue
+		}
+
+		// Edge includes the startKey product as the first result of later pages
+		results := page.APIProducts
+		if startKey != "" && len(results) > 0 && results[0].Name == startKey {
+			results = results[1:]
+		}
+		products = append(products, results...)
+		if len(page.APIProducts) < productsPageSize || len(results) == 0 {
+			break
+		}
+		startKey = results[len(results)-1].Name
+	}
+
+	b.products = products
+	return b.products, nil
+}
+
+// getProductsPage retrieves a page of products starting after startKey (Edge)
+// or at pageToken (GCP)
+func (b *bindings) getProductsPage(startKey, pageToken string) (*productsPage, error) {
+	req, err := b.Client.NewRequestWithContext(b.Context(), http.MethodGet, "", nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "creating request")
 	}
 	req.URL.Path = fmt.Sprintf(productsURLFormat, b.Org) // hack: negate client's base URL
-	req.URL.RawQuery = "expand=true"
+	q := url.Values{}
+	q.Set("expand", "true")
+	if b.IsGCPManaged {
+		q.Set("pageSize", strconv.Itoa(productsPageSize))
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+	} else {
+		q.Set("count", strconv.Itoa(productsPageSize))
+		if startKey != "" {
+			q.Set("startKey", startKey)
+		}
+	}
+	req.URL.RawQuery = q.Encode()
 
-	var res product.APIResponse
-	resp, err := b.Client.Do(req, &res)
+	var page productsPage
+	resp, err := b.Client.Do(req, &page)
 	if err != nil {
 		return nil, errors.Wrap(err, "retrieving products")
 	}
 	defer resp.Body.Close()
 
-	return res.APIProducts, nil
+	return &page, nil
+}
+
+// fetchProduct retrieves the current state of a product from the server, bypassing the cache
+func (b *bindings) fetchProduct(name string) (*product.APIProduct, error) {
+	req, err := b.Client.NewRequestWithContext(b.Context(), http.MethodGet, "", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	req.URL.Path = fmt.Sprintf(productPathFormat, b.Org, name) // hack: negate client's base URL
+
+	var p product.APIProduct
+	resp, err := b.Client.Do(req, &p)
+	if err != nil {
+		if errors.Is(err, apigee.ErrNotFound) {
+			return nil, fmt.Errorf("product %s no longer exists", name)
+		}
+		return nil, errors.Wrapf(err, "retrieving product %s", name)
+	}
+	defer resp.Body.Close()
+
+	return &p, nil
 }
 
 func (b *bindings) cmdList(printf shared.FormatFn) error {
@@ -180,16 +466,12 @@ func (b *bindings) cmdList(printf shared.FormatFn) error {
 	}
 	var bound, unbound []product.APIProduct
 	for _, p := range products {
-		// server returns empty scopes as array with a single empty string, remove for consistency
-		if len(p.Scopes) == 1 && p.Scopes[0] == "" {
-			p.Scopes = []string{}
-		}
-		// server may return empty quota field as "null"
-		if p.QuotaLimit == "null" {
-			p.QuotaLimit = ""
-		}
-		p.Targets = p.GetBoundTargets()
-		if p.Targets == nil {
+		normalize(&p)
+		if b.target != "" {
+			if _, ok := indexOf(p.Targets, b.target); ok {
+				bound = append(bound, p)
+			}
+		} else if p.Targets == nil {
 			unbound = append(unbound, p)
 		} else {
 			bound = append(bound, p)
@@ -198,6 +480,31 @@ func (b *bindings) cmdList(printf shared.FormatFn) error {
 
 	sort.Sort(byName(bound))
 	sort.Sort(byName(unbound))
+
+	switch b.output {
+	case "", outputTable:
+		return printProductsTable(bound, unbound, printf)
+	case outputJSON, outputYAML:
+		return b.printProductsDocument(bound, unbound, printf)
+	default:
+		return fmt.Errorf("invalid output format: %s", b.output)
+	}
+}
+
+// normalize cleans up server values and populates Targets
+func normalize(p *product.APIProduct) {
+	// server returns empty scopes as array with a single empty string, remove for consistency
+	if len(p.Scopes) == 1 && p.Scopes[0] == "" {
+		p.Scopes = []string{}
+	}
+	// server may return empty quota field as "null"
+	if p.QuotaLimit == "null" {
+		p.QuotaLimit = ""
+	}
+	p.Targets = p.GetBoundTargets()
+}
+
+func printProductsTable(bound, unbound []product.APIProduct, printf shared.FormatFn) error {
 	data := struct {
 		Bound   []product.APIProduct
 		Unbound []product.APIProduct
@@ -209,7 +516,7 @@ func (b *bindings) cmdList(printf shared.FormatFn) error {
 	tmp.Funcs(template.FuncMap{
 		"scopes": func(in []string) string { return strings.Join(in, ",") },
 	})
-	tmp, err = tmp.Parse(productsTemplate)
+	tmp, err := tmp.Parse(productsTemplate)
 	if err != nil {
 		return errors.Wrap(err, "creating template")
 	}
@@ -221,6 +528,43 @@ func (b *bindings) cmdList(printf shared.FormatFn) error {
 	return nil
 }
 
+// printProductsDocument prints the bindings as a JSON or YAML document
+func (b *bindings) printProductsDocument(bound, unbound []product.APIProduct, printf shared.FormatFn) error {
+	doc := productBindings{
+		Bound:   make([]productBinding, 0, len(bound)),
+		Unbound: make([]productBinding, 0, len(unbound)),
+	}
+	for _, p := range bound {
+		doc.Bound = append(doc.Bound, newProductBinding(p))
+	}
+	for _, p := range unbound {
+		doc.Unbound = append(doc.Unbound, newProductBinding(p))
+	}
+
+	return b.printDocument(doc, printf)
+}
+
+// printDocument prints doc as JSON or YAML, per --output
+func (b *bindings) printDocument(doc interface{}, printf shared.FormatFn) error {
+	if b.output == outputJSON {
+		out, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "encoding JSON")
+		}
+		printf("%s", out)
+		return nil
+	}
+
+	var yamlBuffer bytes.Buffer
+	yamlEncoder := yaml.NewEncoder(&yamlBuffer)
+	yamlEncoder.SetIndent(2)
+	if err := yamlEncoder.Encode(doc); err != nil {
+		return errors.Wrap(err, "encoding YAML")
+	}
+	printf("%s", yamlBuffer.String())
+	return nil
+}
+
 func (b *bindings) bindTarget(p *product.APIProduct, target string, printf shared.FormatFn) error {
 	boundTargets := p.GetBoundTargets()
 	if _, ok := indexOf(boundTargets, target); ok {
@@ -249,30 +593,101 @@ func (b *bindings) unbindTarget(p *product.APIProduct, target string, printf sha
 	return nil
 }
 
+// updateTargetBindings sets the product's bindings. The product is re-read before
+// writing and, if it was modified since p was read, the changes made relative to p
+// are merged into the current bindings (or a conflictError is returned if noMerge).
 func (b *bindings) updateTargetBindings(p *product.APIProduct, bindings []string) error {
+	current, err := b.fetchProduct(p.Name)
+	if err != nil {
+		return err
+	}
+	if changed := changedAttributes(p.Attributes, current.Attributes); len(changed) > 0 {
+		if b.noMerge {
+			return &conflictError{product: p.Name, attributes: changed}
+		}
+		bindings = mergeTargets(boundTargets(p), bindings, boundTargets(current))
+	}
+
 	bindingsString := strings.Join(bindings, ",")
 	var attributes []product.Attribute
-	for _, a := range p.Attributes {
+	for _, a := range current.Attributes {
 		if a.Name != product.TargetsAttr {
 			attributes = append(attributes, a)
 		}
 	}
-	attributes = append(attributes, product.Attribute{
-		Name:  product.TargetsAttr,
-		Value: bindingsString,
-	})
+	if bindingsString != "" { // omit to remove all bindings
+		attributes = append(attributes, product.Attribute{
+			Name:  product.TargetsAttr,
+			Value: bindingsString,
+		})
+	}
 	newAttrs := attrUpdate{
 		Attributes: attributes,
 	}
-	req, err := b.Client.NewRequest(http.MethodPost, "", newAttrs)
+	req, err := b.Client.NewRequestWithContext(b.Context(), http.MethodPost, "", newAttrs)
 	if err != nil {
 		return err
 	}
 	path := fmt.Sprintf(productAttrPathFormat, b.Org, p.Name)
 	req.URL.Path = path // hack: negate client's base URL
 	var attrResult attrUpdate
-	_, err = b.Client.Do(req, &attrResult)
-	return err
+	if _, err = b.Client.Do(apigee.MarkRetryable(req), &attrResult); err != nil { // replaces all attributes
+		return err
+	}
+
+	p.Attributes = attributes // keep cache current for subsequent updates
+	return nil
+}
+
+// changedAttributes returns the names of attributes that differ between read and current
+func changedAttributes(read, current []product.Attribute) []string {
+	values := make(map[string]string, len(read))
+	for _, a := range read {
+		values[a.Name] = a.Value
+	}
+	var changed []string
+	for _, a := range current {
+		if v, ok := values[a.Name]; !ok || v != a.Value {
+			changed = append(changed, a.Name)
+		}
+		delete(values, a.Name)
+	}
+	for name := range values {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// mergeTargets applies the changes from read to desired onto current
+func mergeTargets(read, desired, current []string) []string {
+	var merged []string
+	for _, t := range current {
+		_, wasRead := indexOf(read, t)
+		_, isDesired := indexOf(desired, t)
+		if isDesired || !wasRead { // keep unless we removed it
+			merged = append(merged, t)
+		}
+	}
+	for _, t := range desired {
+		if _, ok := indexOf(merged, t); !ok {
+			if _, wasRead := indexOf(read, t); !wasRead { // only add what we added
+				merged = append(merged, t)
+			}
+		}
+	}
+	return merged
+}
+
+// conflictError is returned when a product was modified concurrently
+type conflictError struct {
+	product    string
+	attributes []string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("product %s was modified since it was read (changed attributes: %s), no changes made",
+		e.product, strings.Join(e.attributes, ", "))
 }
 
 func indexOf(array []string, val string) (index int, exists bool) {
@@ -291,6 +706,35 @@ type attrUpdate struct {
 	Attributes []product.Attribute `json:"attribute,omitempty"`
 }
 
+// productBindings is the document emitted by list for json and yaml output
+type productBindings struct {
+	Bound   []productBinding `json:"bound" yaml:"bound"`
+	Unbound []productBinding `json:"unbound" yaml:"unbound"`
+}
+
+// productBinding is the structured form of a product and its target bindings
+type productBinding struct {
+	Name          string   `json:"name" yaml:"name"`
+	Scopes        []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	QuotaLimit    string   `json:"quotaLimit,omitempty" yaml:"quotaLimit,omitempty"`
+	QuotaInterval string   `json:"quotaInterval,omitempty" yaml:"quotaInterval,omitempty"`
+	QuotaTimeUnit string   `json:"quotaTimeUnit,omitempty" yaml:"quotaTimeUnit,omitempty"`
+	Targets       []string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Resources     []string `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+func newProductBinding(p product.APIProduct) productBinding {
+	return productBinding{
+		Name:          p.Name,
+		Scopes:        p.Scopes,
+		QuotaLimit:    p.QuotaLimit,
+		QuotaInterval: p.QuotaInterval,
+		QuotaTimeUnit: p.QuotaTimeUnit,
+		Targets:       p.Targets,
+		Resources:     p.Resources,
+	}
+}
+
 type byName []product.APIProduct
 
 func (a byName) Len() int           { return len(a) }
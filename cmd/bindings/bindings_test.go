@@ -16,8 +16,13 @@ package bindings
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/apigee/apigee-remote-service-cli/cmd"
@@ -73,6 +78,103 @@ func TestBindingListOPDK(t *testing.T) {
 	print.Check(t, wants)
 }
 
+func TestBindingListOutput(t *testing.T) {
+
+	print := testutil.Printer("TestBindingListOutput")
+	ts := productTestServer()
+	defer ts.Close()
+
+	var err error
+	var flags []string
+	var rootCmd *cobra.Command
+	var rootArgs *shared.RootArgs
+	var wants []string
+
+	flags = []string{"bindings", "list", "--output", "json", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{`{
+  "bound": [
+    {
+      "name": "/product2/",
+      "targets": [
+        "/target/"
+      ]
+    }
+  ],
+  "unbound": [
+    {
+      "name": "/product/"
+    }
+  ]
+}`}
+	print.Check(t, wants)
+
+	flags = []string{"bindings", "list", "--output", "yaml", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{`bound:
+- name: /product2/
+  targets:
+  - /target/
+unbound:
+- name: /product/
+`}
+	print.Check(t, wants)
+
+	flags = []string{"bindings", "list", "--output", "xml", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	wantErr := "invalid output format: xml"
+	if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+		t.Errorf("want %s, got: %v", wantErr, err)
+	}
+
+	// output isn't a format string
+	res := product.APIResponse{
+		APIProducts: []product.APIProduct{
+			{
+				Name: "/product%d/",
+				Attributes: []product.Attribute{
+					{
+						Name:  product.TargetsAttr,
+						Value: "/target%s/",
+					},
+				},
+			},
+		},
+	}
+	ts2 := newProductTestServer(res, res.APIProducts, nil)
+	defer ts2.Close()
+	for _, output := range []string{"json", "yaml"} {
+		print.Prints = nil
+		flags = []string{"bindings", "list", "--output", output, "--opdk", "--runtime", ts2.URL,
+			"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+		rootArgs = &shared.RootArgs{}
+		rootCmd = cmd.GetRootCmd(flags, print.Printf)
+		shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+		if err = rootCmd.Execute(); err != nil {
+			t.Errorf("want no error, got: %v", err)
+		}
+		if len(print.Prints) != 1 || !strings.Contains(print.Prints[0], "/product%d/") ||
+			!strings.Contains(print.Prints[0], "/target%s/") {
+			t.Errorf("%s output want names as is, got: %v", output, print.Prints)
+		}
+	}
+}
+
 func TestBindingAddOPDK(t *testing.T) {
 
 	print := testutil.Printer("TestBindingAddOPDK")
@@ -108,6 +210,65 @@ func TestBindingAddOPDK(t *testing.T) {
 	print.Check(t, wants)
 }
 
+func TestBindingBulkOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestBindingBulkOPDK")
+	ts := productTestServer()
+	defer ts.Close()
+
+	var err error
+	var flags []string
+	var rootCmd *cobra.Command
+	var rootArgs *shared.RootArgs
+	var wants []string
+
+	flags = []string{"bindings", "add", "/target/", "/product*/", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{
+		"product /product/ is now bound to: /target/",
+		"target /target/ is already bound to /product2/",
+		"target /target/: 2 product(s) succeeded, 0 failed",
+	}
+	print.Check(t, wants)
+
+	flags = []string{"bindings", "add", "/target/", "/product/", "/missing/", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	wantErr := "failed to update 1 product(s)"
+	if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+		t.Errorf("want %s, got: %v", wantErr, err)
+	}
+	wants = []string{
+		"product /product/ is now bound to: /target/",
+		"target /target/: 1 product(s) succeeded, 1 failed",
+		"  /missing/: invalid product name",
+	}
+	print.Check(t, wants)
+
+	flags = []string{"bindings", "remove", "/target/", "--all-products", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{
+		"target /target/ is not bound to /product/",
+		"product /product2/ is no longer bound to: /target/",
+		"target /target/: 2 product(s) succeeded, 0 failed",
+	}
+	print.Check(t, wants)
+}
+
 func TestBindingRemoveOPDK(t *testing.T) {
 
 	print := testutil.Printer("TestBindingRemoveOPDK")
@@ -143,9 +304,510 @@ func TestBindingRemoveOPDK(t *testing.T) {
 	print.Check(t, wants)
 }
 
-func productTestServer() *httptest.Server {
+func TestBindingApplyOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestBindingApplyOPDK")
+	ts := productTestServer()
+	defer ts.Close()
+
+	manifest, err := ioutil.TempFile("", "bindings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(manifest.Name())
+	manifest.WriteString(`products:
+- name: /product/
+  targets:
+  - /target/
+  - /target2/
+`)
+	manifest.Close()
+
+	var flags []string
+	var rootCmd *cobra.Command
+	var rootArgs *shared.RootArgs
+	var wants []string
+
+	flags = []string{"bindings", "apply", "-f", manifest.Name(), "--dry-run", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{
+		"planned changes:",
+		"/product/:",
+		"  + /target/",
+		"  + /target2/",
+	}
+	print.Check(t, wants)
+
+	flags = []string{"bindings", "apply", "-f", manifest.Name(), "--prune", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{
+		"planned changes:",
+		"/product/:",
+		"  + /target/",
+		"  + /target2/",
+		"/product2/:",
+		"  - /target/",
+		"product /product/ is now bound to: /target/,/target2/",
+		"product /product2/ is no longer bound to any target",
+	}
+	print.Check(t, wants)
+
+	ioutil.WriteFile(manifest.Name(), []byte("products:\n- name: /missing/\n"), 0644)
+	flags = []string{"bindings", "apply", "-f", manifest.Name(), "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	wantErr := "invalid product name: /missing/"
+	if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+		t.Errorf("want %s, got: %v", wantErr, err)
+	}
+	print.Check(t, nil)
+
+	// a misspelled key is rejected
+	ioutil.WriteFile(manifest.Name(), []byte("products:\n- name: /product/\n  target:\n  - /target/\n"), 0644)
+	flags = []string{"bindings", "apply", "-f", manifest.Name(), "--prune", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "field target not found") {
+		t.Errorf("want unknown field error, got: %v", err)
+	}
+	print.Check(t, nil)
+
+	// --prune with no products would unbind everything
+	for _, content := range []string{"", "products: []\n"} {
+		ioutil.WriteFile(manifest.Name(), []byte(content), 0644)
+		rootArgs = &shared.RootArgs{}
+		rootCmd = cmd.GetRootCmd(flags, print.Printf)
+		shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+		wantErr = "--prune requires a manifest that lists products, " + manifest.Name() + " lists none"
+		if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+			t.Errorf("want %s, got: %v", wantErr, err)
+		}
+		print.Check(t, nil)
+	}
+}
+
+func TestBindingConcurrentUpdateOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestBindingConcurrentUpdateOPDK")
+
+	// another operator bound /other/ and added an attribute since the list was read
+	current := testProducts().APIProducts
+	current[1].Attributes = []product.Attribute{
+		{Name: "access", Value: "public"},
+		{Name: product.TargetsAttr, Value: "/target/,/other/"},
+	}
+	var updates []attrUpdate
+	ts := newProductTestServer(testProducts(), current, &updates)
+	defer ts.Close()
+
+	var err error
+	var flags []string
+	var rootCmd *cobra.Command
+	var rootArgs *shared.RootArgs
+	var wants []string
+
+	flags = []string{"bindings", "remove", "/target/", "/product2/", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{"product /product2/ is no longer bound to: /target/"}
+	print.Check(t, wants)
+
+	wantAttrs := []product.Attribute{
+		{Name: "access", Value: "public"},
+		{Name: product.TargetsAttr, Value: "/other/"},
+	}
+	if len(updates) != 1 || !reflect.DeepEqual(updates[0].Attributes, wantAttrs) {
+		t.Errorf("want update %v, got: %v", wantAttrs, updates)
+	}
+
+	updates = nil
+	flags = []string{"bindings", "remove", "/target/", "/product2/", "--no-merge", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	wantErr := "removing target /target/ from /product2/: product /product2/ was modified since it was read " +
+		"(changed attributes: access, apigee-remote-service-targets), no changes made"
+	if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+		t.Errorf("want %s, got: %v", wantErr, err)
+	}
+	if len(updates) != 0 {
+		t.Errorf("want no updates, got: %v", updates)
+	}
+	print.Check(t, nil)
+}
+
+func TestBindingListPagedOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestBindingListPagedOPDK")
+
+	defer func(size int) { productsPageSize = size }(productsPageSize)
+	productsPageSize = 2
+
+	var names []string
+	for _, n := range []string{"a", "b", "c", "d", "e"} {
+		names = append(names, "/product-"+n+"/")
+	}
+	var startKeys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startKey := r.URL.Query().Get("startKey")
+		startKeys = append(startKeys, startKey)
+		count, err := strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil {
+			t.Errorf("invalid count: %v", err)
+		}
+		start := 0
+		for i, n := range names {
+			if n == startKey {
+				start = i
+			}
+		}
+		end := start + count
+		if end > len(names) {
+			end = len(names)
+		}
+		var res product.APIResponse
+		for _, n := range names[start:end] {
+			res.APIProducts = append(res.APIProducts, product.APIProduct{Name: n})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer ts.Close()
+
+	flags := []string{"bindings", "list", "--output", "json", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error, got: %v", err)
+	}
+
+	var got productBindings
+	if err := json.Unmarshal([]byte(strings.Join(print.Prints, "")), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	var gotNames []string
+	for _, p := range got.Unbound {
+		gotNames = append(gotNames, p.Name)
+	}
+	if !reflect.DeepEqual(gotNames, names) {
+		t.Errorf("want products %v, got: %v", names, gotNames)
+	}
+	wantStartKeys := []string{"", "/product-b/", "/product-c/", "/product-d/", "/product-e/"}
+	if !reflect.DeepEqual(startKeys, wantStartKeys) {
+		t.Errorf("want start keys %v, got: %v", wantStartKeys, startKeys)
+	}
+}
+
+func TestBindingAddCreateProductOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestBindingAddCreateProductOPDK")
+	var updates []attrUpdate
+	ts := newProductTestServer(testProducts(), testProducts().APIProducts, &updates)
+	defer ts.Close()
+
+	var err error
+	var flags []string
+	var rootCmd *cobra.Command
+	var rootArgs *shared.RootArgs
+	var wants []string
+
+	flags = []string{"bindings", "add", "/target/", "/new/", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	wantErr := "invalid product name: /new/"
+	if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+		t.Errorf("want %s, got: %v", wantErr, err)
+	}
+	print.Check(t, nil)
+
+	flags = []string{"bindings", "add", "/target/", "/new/", "--create-product", "--paths", "/,/v1/**",
+		"--quota", "10", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{
+		"product /new/ created",
+		"product /new/ is now bound to: /target/",
+	}
+	print.Check(t, wants)
+
+	wantAttrs := []product.Attribute{{Name: product.TargetsAttr, Value: "/target/"}}
+	if len(updates) != 1 || !reflect.DeepEqual(updates[0].Attributes, wantAttrs) {
+		t.Errorf("want update %v, got: %v", wantAttrs, updates)
+	}
+}
+
+func TestBindingVerifyOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestBindingVerifyOPDK")
+
+	good := product.APIProduct{
+		Name:         "/good/",
+		Environments: []string{"/env/"},
+		Resources:    []string{"/"},
+		Attributes:   []product.Attribute{{Name: product.TargetsAttr, Value: "/target/"}},
+	}
+	res := product.APIResponse{
+		APIProducts: []product.APIProduct{
+			good,
+			{
+				Name:          "/wrongenv/",
+				Environments:  []string{"/other/"},
+				Resources:     []string{"/"},
+				QuotaLimit:    "10",
+				QuotaInterval: "1",
+				QuotaTimeUnit: "minute",
+				Attributes:    []product.Attribute{{Name: product.TargetsAttr, Value: "/target/"}},
+			},
+			{
+				Name:       "/noenv/",
+				QuotaLimit: "5",
+				Attributes: []product.Attribute{{Name: product.TargetsAttr, Value: "/target2/"}},
+			},
+			{
+				Name: "/unbound/",
+			},
+		},
+	}
+	ts := newProductTestServer(res, res.APIProducts, nil)
+	defer ts.Close()
+
+	var err error
+	var flags []string
+	var rootCmd *cobra.Command
+	var rootArgs *shared.RootArgs
+	var wants []string
+
+	flags = []string{"bindings", "verify", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	wantErr := "found 5 problem(s) in 3 bound product(s)"
+	if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+		t.Errorf("want %s, got: %v", wantErr, err)
+	}
+	wants = []string{
+		"product /noenv/ has no environments",
+		"product /noenv/ has no resource paths",
+		"product /noenv/ has a quota limit without an interval and time unit",
+		"product /wrongenv/ is not available in environment /env/",
+		"target /target/ is bound to products with conflicting scopes or quota: /good/, /wrongenv/",
+	}
+	print.Check(t, wants)
+
+	res.APIProducts = []product.APIProduct{good}
+	ts2 := newProductTestServer(res, res.APIProducts, nil)
+	defer ts2.Close()
+
+	flags = []string{"bindings", "verify", "--opdk", "--runtime", ts2.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{"verified 1 bound product(s), no problems found"}
+	print.Check(t, wants)
+
+	// problems aren't format strings
+	res.APIProducts = []product.APIProduct{{
+		Name:       "/50%s/",
+		Resources:  []string{"/"},
+		Attributes: []product.Attribute{{Name: product.TargetsAttr, Value: "/target/"}},
+	}}
+	ts3 := newProductTestServer(res, res.APIProducts, nil)
+	defer ts3.Close()
+
+	flags = []string{"bindings", "verify", "--opdk", "--runtime", ts3.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	wantErr = "found 1 problem(s) in 1 bound product(s)"
+	if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+		t.Errorf("want %s, got: %v", wantErr, err)
+	}
+	wants = []string{"product /50%s/ has no environments"}
+	print.Check(t, wants)
+}
+
+func TestBindingTargetsOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestBindingTargetsOPDK")
 
 	res := product.APIResponse{
+		APIProducts: []product.APIProduct{
+			{
+				Name:          "/product/",
+				Scopes:        []string{"scope1", "scope2"},
+				Resources:     []string{"/a", "/b"},
+				QuotaLimit:    "10",
+				QuotaInterval: "1",
+				QuotaTimeUnit: "minute",
+				Attributes:    []product.Attribute{{Name: product.TargetsAttr, Value: "/target/,/target2/"}},
+			},
+			{
+				Name:       "/product2/",
+				Resources:  []string{"/"},
+				Attributes: []product.Attribute{{Name: product.TargetsAttr, Value: "/target/"}},
+			},
+			{
+				Name: "/unbound/",
+			},
+		},
+	}
+	ts := newProductTestServer(res, res.APIProducts, nil)
+	defer ts.Close()
+
+	var err error
+	var flags []string
+	var rootCmd *cobra.Command
+	var rootArgs *shared.RootArgs
+
+	flags = []string{"bindings", "targets", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	want := `
+Remote Targets
+==============
+/target/:
+  /product/:
+    Scopes: scope1,scope2
+    Quota: 10 requests every 1 minute
+    Paths:
+      /a
+      /b
+  /product2/:
+    Paths:
+      /
+/target2/:
+  /product/:
+    Scopes: scope1,scope2
+    Quota: 10 requests every 1 minute
+    Paths:
+      /a
+      /b
+`
+	if got := strings.Join(print.Prints, ""); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	print.Prints = nil
+
+	flags = []string{"bindings", "targets", "--target", "/target2/", "--output", "json", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	print.Check(t, []string{`[
+  {
+    "target": "/target2/",
+    "products": [
+      {
+        "name": "/product/",
+        "scopes": [
+          "scope1",
+          "scope2"
+        ],
+        "quotaLimit": "10",
+        "quotaInterval": "1",
+        "quotaTimeUnit": "minute",
+        "targets": [
+          "/target/",
+          "/target2/"
+        ],
+        "resources": [
+          "/a",
+          "/b"
+        ]
+      }
+    ]
+  }
+]`})
+
+	flags = []string{"bindings", "list", "--target", "/target/", "--output", "yaml", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	print.Check(t, []string{`bound:
+- name: /product/
+  scopes:
+  - scope1
+  - scope2
+  quotaLimit: "10"
+  quotaInterval: "1"
+  quotaTimeUnit: minute
+  targets:
+  - /target/
+  - /target2/
+  resources:
+  - /a
+  - /b
+- name: /product2/
+  targets:
+  - /target/
+  resources:
+  - /
+unbound: []
+`})
+
+	flags = []string{"bindings", "targets", "--target", "/missing/", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	wantErr := "no products are bound to target /missing/"
+	if err = rootCmd.Execute(); err == nil || err.Error() != wantErr {
+		t.Errorf("want %s, got: %v", wantErr, err)
+	}
+	print.Check(t, nil)
+}
+
+func testProducts() product.APIResponse {
+	return product.APIResponse{
 		APIProducts: []product.APIProduct{
 			{
 				Name: "/product/",
@@ -161,10 +823,44 @@ func productTestServer() *httptest.Server {
 			},
 		},
 	}
+}
+
+func productTestServer() *httptest.Server {
+	res := testProducts()
+	return newProductTestServer(res, res.APIProducts, nil)
+}
+
+// newProductTestServer serves res as the product list and current as individual
+// products. Attribute updates are recorded in updates, if not nil. Created
+// products are added to current.
+func newProductTestServer(res product.APIResponse, current []product.APIProduct, updates *[]attrUpdate) *httptest.Server {
 
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(res)
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/apiproducts"):
+			var p product.APIProduct
+			json.NewDecoder(r.Body).Decode(&p)
+			current = append(current, p)
+			json.NewEncoder(w).Encode(p)
+		case strings.HasSuffix(r.URL.Path, "/apiproducts"):
+			json.NewEncoder(w).Encode(res)
+		case strings.HasSuffix(r.URL.Path, "/attributes"):
+			var update attrUpdate
+			json.NewDecoder(r.Body).Decode(&update)
+			if updates != nil {
+				*updates = append(*updates, update)
+			}
+			json.NewEncoder(w).Encode(update)
+		default:
+			for _, p := range current {
+				if strings.HasSuffix(r.URL.Path, "/apiproducts/"+p.Name) {
+					json.NewEncoder(w).Encode(p)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
 	}))
 }
 
@@ -200,7 +896,7 @@ func testBindingsParams(t *testing.T, args ...string) {
 	}
 
 	// hybrid requires token
-	wantErr = "--token is required for hybrid"
+	wantErr = "--token, --service-account, --adc, or --auth is required for hybrid"
 	flags = []string{"bindings", "--runtime", "/runtime/"}
 	flags = append(flags, args...)
 	rootArgs = &shared.RootArgs{}
@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-golib/product"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// targetBinding is a Remote Target and the products bound to it
+type targetBinding struct {
+	Target   string           `json:"target" yaml:"target"`
+	Products []productBinding `json:"products" yaml:"products"`
+}
+
+func cmdBindingsTargets(b *bindings, printf shared.FormatFn) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "targets",
+		Short: "List Remote Targets and their Apigee Products",
+		Long:  "List Remote Targets and the Apigee Products, scopes, paths, and quotas that apply to each",
+		Args:  cobra.NoArgs,
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return b.cmdTargets(printf)
+		},
+	}
+
+	c.Flags().StringVarP(&b.output, "output", "", outputTable,
+		"output format: table, json, or yaml")
+	c.Flags().StringVarP(&b.target, "target", "", "",
+		"only list the specified target")
+
+	return c
+}
+
+func (b *bindings) cmdTargets(printf shared.FormatFn) error {
+	products, err := b.getProducts()
+	if err != nil {
+		return err
+	}
+
+	targets, err := b.targetBindings(products)
+	if err != nil {
+		return err
+	}
+
+	switch b.output {
+	case "", outputTable:
+		return printTargetsTable(targets, printf)
+	case outputJSON, outputYAML:
+		return b.printDocument(targets, printf)
+	default:
+		return fmt.Errorf("invalid output format: %s", b.output)
+	}
+}
+
+// targetBindings inverts the product bindings, sorted by target and product name
+func (b *bindings) targetBindings(products []product.APIProduct) ([]targetBinding, error) {
+	byTarget := make(map[string][]productBinding)
+	for _, p := range products {
+		normalize(&p)
+		for _, t := range boundTargets(&p) {
+			if b.target == "" || b.target == t {
+				byTarget[t] = append(byTarget[t], newProductBinding(p))
+			}
+		}
+	}
+	if b.target != "" && len(byTarget) == 0 {
+		return nil, fmt.Errorf("no products are bound to target %s", b.target)
+	}
+
+	targets := make([]targetBinding, 0, len(byTarget))
+	for t, ps := range byTarget {
+		sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+		targets = append(targets, targetBinding{Target: t, Products: ps})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Target < targets[j].Target })
+	return targets, nil
+}
+
+func printTargetsTable(targets []targetBinding, printf shared.FormatFn) error {
+	tmp := template.New("targets")
+	tmp.Funcs(template.FuncMap{
+		"scopes": func(in []string) string { return strings.Join(in, ",") },
+	})
+	tmp, err := tmp.Parse(targetsTemplate)
+	if err != nil {
+		return errors.Wrap(err, "creating template")
+	}
+	err = tmp.Execute(shared.FormatFnWriter(printf), targets)
+	if err != nil {
+		return errors.Wrap(err, "executing template")
+	}
+	return nil
+}
+
+const targetsTemplate = `
+{{- define "product"}}
+  {{.Name}}:
+ {{- if .Scopes}}
+    Scopes: {{scopes (.Scopes)}}
+ {{- end}}
+ {{- if .QuotaLimit}}
+    Quota: {{.QuotaLimit}} requests every {{.QuotaInterval}} {{.QuotaTimeUnit}}
+ {{- end}}
+    Paths:
+ {{- range .Resources}}
+      {{.}}
+ {{- end}}
+{{- end}}
+Remote Targets
+==============
+{{- range .}}
+{{.Target}}:
+ {{- range .Products}}
+ {{- template "product" .}}
+ {{- end}}
+{{- end}}
+`
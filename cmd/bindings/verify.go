@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-golib/product"
+	"github.com/spf13/cobra"
+)
+
+func cmdBindingsVerify(b *bindings, printf shared.FormatFn) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify Apigee Products bound to Remote Targets are usable",
+		Long: `Verify Apigee Products bound to Remote Targets are usable. Reports bound Products that
+have no environments, are not available in the --environment, have no resource paths or
+an incomplete quota, and targets bound to multiple Products with conflicting scopes or quotas.
+Exits with an error if any problems are found.`,
+		Args: cobra.NoArgs,
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cmd.SilenceUsage = true
+			return b.verify(printf)
+		},
+	}
+
+	return c
+}
+
+func (b *bindings) verify(printf shared.FormatFn) error {
+	products, err := b.getProducts()
+	if err != nil {
+		return err
+	}
+
+	var bound []product.APIProduct
+	for _, p := range products {
+		normalize(&p)
+		if len(boundTargets(&p)) > 0 {
+			bound = append(bound, p)
+		}
+	}
+	sort.Sort(byName(bound))
+
+	var problems []string
+	productsByTarget := make(map[string][]product.APIProduct)
+	for _, p := range bound {
+		problems = append(problems, b.verifyProduct(p)...)
+		for _, t := range boundTargets(&p) {
+			productsByTarget[t] = append(productsByTarget[t], p)
+		}
+	}
+
+	var targets []string
+	for t := range productsByTarget {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+	for _, t := range targets {
+		if ps := productsByTarget[t]; hasConflicts(ps) {
+			var names []string
+			for _, p := range ps {
+				names = append(names, p.Name)
+			}
+			problems = append(problems, fmt.Sprintf("target %s is bound to products with conflicting scopes or quota: %s",
+				t, strings.Join(names, ", ")))
+		}
+	}
+
+	if len(problems) == 0 {
+		printf("verified %d bound product(s), no problems found", len(bound))
+		return nil
+	}
+	for _, problem := range problems {
+		printf("%s", problem)
+	}
+	return fmt.Errorf("found %d problem(s) in %d bound product(s)", len(problems), len(bound))
+}
+
+// verifyProduct returns the problems found with a bound product
+func (b *bindings) verifyProduct(p product.APIProduct) []string {
+	var problems []string
+	if len(p.Environments) == 0 {
+		problems = append(problems, fmt.Sprintf("product %s has no environments", p.Name))
+	} else if b.Env != "" {
+		if _, ok := indexOf(p.Environments, b.Env); !ok {
+			problems = append(problems, fmt.Sprintf("product %s is not available in environment %s", p.Name, b.Env))
+		}
+	}
+	if len(p.Resources) == 0 {
+		problems = append(problems, fmt.Sprintf("product %s has no resource paths", p.Name))
+	}
+	if p.QuotaLimit != "" && (p.QuotaInterval == "" || p.QuotaTimeUnit == "") {
+		problems = append(problems, fmt.Sprintf("product %s has a quota limit without an interval and time unit", p.Name))
+	}
+	return problems
+}
+
+// hasConflicts returns true if the products differ in scopes or quota
+func hasConflicts(products []product.APIProduct) bool {
+	key := func(p product.APIProduct) string {
+		scopes := append([]string{}, p.Scopes...)
+		sort.Strings(scopes)
+		return fmt.Sprintf("%s|%s|%s|%s", strings.Join(scopes, ","), p.QuotaLimit, p.QuotaInterval, p.QuotaTimeUnit)
+	}
+	for _, p := range products[1:] {
+		if key(p) != key(products[0]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,439 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apigee/apigee-remote-service-cli/cmd/provision"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	appName = "remote-service"
+
+	applicationPathFormat = "developers/%s/apps/%s"         // developer email, app name
+	keyPathFormat         = "developers/%s/apps/%s/keys/%s" // developer email, app name, key ID
+
+	statusApproved = "approved"
+)
+
+type credentials struct {
+	*shared.RootArgs
+	developerEmail string
+}
+
+// Cmd returns base command
+func Cmd(rootArgs *shared.RootArgs, printf shared.FormatFn) *cobra.Command {
+	cr := &credentials{RootArgs: rootArgs}
+
+	c := &cobra.Command{
+		Use:   "credentials",
+		Short: "Manage the credentials used by remote services",
+		Long: `Manage the credentials (keys and secrets) that provision creates for remote services. On hybrid,
+these are the keys of the remote-service app.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := rootArgs.Resolve(false, false); err != nil {
+				return err
+			}
+			missingFlagNames := []string{}
+			if cr.Org == "" {
+				missingFlagNames = append(missingFlagNames, "organization")
+			}
+			if cr.IsGCPManaged && cr.developerEmail == "" {
+				missingFlagNames = append(missingFlagNames, "developer-email")
+			}
+			return cr.PrintMissingFlags(missingFlagNames)
+		},
+	}
+
+	c.PersistentFlags().StringVarP(&rootArgs.ManagementBase, "management", "m",
+		shared.DefaultManagementBase, "Apigee management base URL")
+	c.PersistentFlags().BoolVarP(&rootArgs.IsLegacySaaS, "legacy", "", false,
+		"Apigee SaaS (sets management and runtime URL)")
+	c.PersistentFlags().BoolVarP(&rootArgs.IsOPDK, "opdk", "", false,
+		"Apigee opdk")
+	c.PersistentFlags().StringVarP(&rootArgs.Token, "token", "t", "",
+		"Apigee OAuth or SAML token (hybrid only)")
+	c.PersistentFlags().StringVarP(&rootArgs.ServiceAccount, "service-account", "", "",
+		"Google service account key file for OAuth tokens (hybrid only)")
+	c.PersistentFlags().BoolVarP(&rootArgs.UseADC, "adc", "", false,
+		"use Google Application Default Credentials for OAuth tokens (hybrid only)")
+	c.PersistentFlags().StringVarP(&rootArgs.Username, "username", "u", "",
+		"Apigee username (legacy or OPDK only)")
+	c.PersistentFlags().StringVarP(&rootArgs.Password, "password", "p", "",
+		"Apigee password (legacy or OPDK only)")
+	c.PersistentFlags().StringVarP(&cr.developerEmail, "developer-email", "d", "",
+		"email of the developer used by provision (hybrid only)")
+
+	c.AddCommand(cmdList(cr, printf))
+	c.AddCommand(cmdPrune(cr, printf))
+	c.AddCommand(cmdRotate(cr, printf))
+	c.AddCommand(cmdRevoke(cr, printf))
+
+	return c
+}
+
+func cmdList(cr *credentials, printf shared.FormatFn) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "list",
+		Short: "List the credentials of the remote-service app",
+		Long: `List the credentials of the remote-service app (hybrid only). The credential of --config, if
+specified, is marked as in use.`,
+		Args: cobra.NoArgs,
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := cr.requireHybrid(); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			return cr.list(printf)
+		},
+	}
+
+	return c
+}
+
+func cmdPrune(cr *credentials, printf shared.FormatFn) *cobra.Command {
+	var keep []string
+	var yes bool
+	c := &cobra.Command{
+		Use:   "prune",
+		Short: "Revoke unused credentials of the remote-service app",
+		Long: `Revoke the approved credentials of the remote-service app except for the credential of
+--config and those passed to --keep (hybrid only).`,
+		Args: cobra.NoArgs,
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := cr.requireHybrid(); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			return cr.prune(keep, yes, cmd.InOrStdin(), printf)
+		},
+	}
+
+	c.Flags().StringSliceVarP(&keep, "keep", "", nil,
+		"comma-separated keys to keep in addition to the key of --config")
+	c.Flags().BoolVarP(&yes, "yes", "y", false,
+		"don't prompt for confirmation")
+
+	return c
+}
+
+func cmdRotate(cr *credentials, printf shared.FormatFn) *cobra.Command {
+	var namespace string
+	var grace time.Duration
+	c := &cobra.Command{
+		Use:   "rotate",
+		Short: "Create a new credential and print the updated config",
+		Long: `Create a new credential for the config specified by --config and print the config updated
+to use it. On hybrid, this is a new key of the remote-service app. The previous key remains valid until
+the --grace period passes or it's revoked by "credentials revoke --old", so that the updated config
+can be deployed first. With --grace, rotate waits in the foreground for the period before revoking; if
+it's interrupted, run "credentials revoke --old" instead. Previous credentials of legacy SaaS or OPDK
+can't be revoked.`,
+		Args: cobra.NoArgs,
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if cr.ServerConfig == nil {
+				return fmt.Errorf("rotate requires --config")
+			}
+			if grace > 0 && !cr.IsGCPManaged {
+				return fmt.Errorf("--grace is only supported for hybrid")
+			}
+			cmd.SilenceUsage = true
+			return cr.rotate(namespace, grace, printf)
+		},
+	}
+
+	c.Flags().StringVarP(&namespace, "namespace", "n", "",
+		"emit configuration as an Envoy ConfigMap in the specified namespace")
+	c.Flags().DurationVarP(&grace, "grace", "", 0,
+		"wait this period, eg. 1h, then revoke the previous key (hybrid only)")
+
+	return c
+}
+
+func cmdRevoke(cr *credentials, printf shared.FormatFn) *cobra.Command {
+	var old bool
+	c := &cobra.Command{
+		Use:   "revoke [key]",
+		Short: "Revoke a credential of the remote-service app",
+		Long: `Revoke a credential of the remote-service app (hybrid only). With --old, revoke the credentials
+issued before the credential of --config, such as those replaced by "credentials rotate".`,
+		Args: cobra.MaximumNArgs(1),
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cr.requireHybrid(); err != nil {
+				return err
+			}
+			if old == (len(args) == 1) {
+				return fmt.Errorf("specify either a key or --old")
+			}
+			if old && cr.ServerConfig == nil {
+				return fmt.Errorf("--old requires --config")
+			}
+			cmd.SilenceUsage = true
+			if old {
+				return cr.revokeOld(printf)
+			}
+			if err := cr.revoke(args[0]); err != nil {
+				return errors.Wrapf(err, "revoking credential %s", args[0])
+			}
+			printf("credential %s revoked", args[0])
+			return nil
+		},
+	}
+
+	c.Flags().BoolVarP(&old, "old", "", false,
+		"revoke the credentials issued before the credential of --config")
+
+	return c
+}
+
+// requireHybrid returns an error unless the org is hybrid, as only hybrid
+// credentials are keys of an app
+func (cr *credentials) requireHybrid() error {
+	if !cr.IsGCPManaged {
+		return fmt.Errorf("only supported for hybrid")
+	}
+	return nil
+}
+
+// list prints the credentials of the app
+func (cr *credentials) list(printf shared.FormatFn) error {
+	app, err := cr.getApp()
+	if err != nil {
+		return err
+	}
+
+	inUse := cr.configKey()
+	printf("credentials of app %s of developer %s:", appName, cr.developerEmail)
+	for _, cred := range app.Credentials {
+		line := fmt.Sprintf("  %s: %s, issued %s", cred.Key, cred.Status, formatTime(cred.IssuedAt))
+		if cred.Key == inUse {
+			line += " (in use by config)"
+		}
+		printf("%s", line)
+	}
+	if len(app.Credentials) == 0 {
+		printf("  none")
+	}
+	return nil
+}
+
+// prune revokes the approved credentials of the app that aren't kept
+func (cr *credentials) prune(keep []string, yes bool, in io.Reader, printf shared.FormatFn) error {
+	kept := map[string]bool{}
+	for _, key := range keep {
+		kept[strings.TrimSpace(key)] = true
+	}
+	if key := cr.configKey(); key != "" {
+		kept[key] = true
+	}
+	if len(kept) == 0 {
+		return fmt.Errorf("--config or --keep is required so that a credential remains")
+	}
+
+	app, err := cr.getApp()
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	found := 0
+	for _, cred := range app.Credentials {
+		if kept[cred.Key] {
+			found++
+		} else if cred.Status == statusApproved {
+			stale = append(stale, cred.Key)
+		}
+	}
+	if found < len(kept) {
+		return fmt.Errorf("%d of the kept keys are not credentials of app %s, no changes made", len(kept)-found, appName)
+	}
+	if len(stale) == 0 {
+		printf("no credentials to revoke")
+		return nil
+	}
+
+	printf("revoking %d credential(s) of app %s will:", len(stale), appName)
+	for _, key := range stale {
+		printf("  revoke %s", key)
+	}
+	if !yes && !shared.Confirm(in, printf) {
+		printf("prune cancelled")
+		return nil
+	}
+
+	for _, key := range stale {
+		if err := cr.revoke(key); err != nil {
+			return errors.Wrapf(err, "revoking credential %s", key)
+		}
+		printf("credential %s revoked", key)
+	}
+	return nil
+}
+
+// rotate creates a new credential, prints the config updated to use it and,
+// after the grace period if set, revokes the previous key
+func (cr *credentials) rotate(namespace string, grace time.Duration, printf shared.FormatFn) error {
+	var verbosef = shared.NoPrintf
+	if cr.Verbose {
+		verbosef = printf
+	}
+
+	config := *cr.ServerConfig
+	oldKey := config.Tenant.Key
+
+	key, secret, err := provision.CreateCredential(cr.RootArgs, cr.developerEmail, verbosef)
+	if err != nil {
+		return errors.Wrap(err, "creating credential")
+	}
+	config.Tenant.Key = key
+	config.Tenant.Secret = secret
+	if err := provision.PrintConfig(config, "credentials rotate", namespace, printf); err != nil {
+		return errors.Wrap(err, "generating config")
+	}
+
+	if !cr.IsGCPManaged {
+		shared.Errorf("note: the previous credential %s remains valid, it can't be revoked for legacy SaaS or OPDK", oldKey)
+		return nil
+	}
+	if grace == 0 {
+		shared.Errorf("the previous key %s remains valid, once the new config is deployed revoke it with: credentials revoke --old", oldKey)
+		return nil
+	}
+
+	shared.Errorf("waiting %s to revoke the previous key %s, if interrupted revoke it with: credentials revoke --old", grace, oldKey)
+	select {
+	case <-time.After(grace):
+	case <-cr.Context().Done():
+		return errors.Wrapf(cr.Context().Err(), "previous key %s not revoked, revoke it with: credentials revoke --old", oldKey)
+	}
+	if err := cr.revoke(oldKey); err != nil {
+		return errors.Wrapf(err, "revoking credential %s", oldKey)
+	}
+	shared.Errorf("credential %s revoked", oldKey)
+	return nil
+}
+
+// revokeOld revokes the approved credentials issued before the credential of
+// the config. Credentials with an unknown issue time are skipped.
+func (cr *credentials) revokeOld(printf shared.FormatFn) error {
+	app, err := cr.getApp()
+	if err != nil {
+		return err
+	}
+
+	current := cr.configKey()
+	var issuedAt int64
+	found := false
+	for _, cred := range app.Credentials {
+		if cred.Key == current {
+			issuedAt = millis(cred.IssuedAt)
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("key %s of the config is not a credential of app %s", current, appName)
+	}
+	if issuedAt <= 0 {
+		return fmt.Errorf("key %s of the config has an unknown issue time", current)
+	}
+
+	revoked := 0
+	for _, cred := range app.Credentials {
+		if cred.Key == current || cred.Status != statusApproved {
+			continue
+		}
+		t := millis(cred.IssuedAt)
+		if t <= 0 {
+			printf("credential %s has an unknown issue time, skipping", cred.Key)
+			continue
+		}
+		if t >= issuedAt {
+			continue
+		}
+		if err := cr.revoke(cred.Key); err != nil {
+			return errors.Wrapf(err, "revoking credential %s", cred.Key)
+		}
+		printf("credential %s revoked", cred.Key)
+		revoked++
+	}
+	if revoked == 0 {
+		printf("no credentials to revoke")
+	}
+	return nil
+}
+
+// getApp returns the remote-service app of the developer
+func (cr *credentials) getApp() (*shared.App, error) {
+	appPath := fmt.Sprintf(applicationPathFormat, cr.developerEmail, appName)
+	req, err := cr.Client.NewRequestNoEnvWithContext(cr.Context(), http.MethodGet, appPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var app shared.App
+	if _, err = cr.Client.Do(req, &app); err != nil {
+		return nil, errors.Wrapf(err, "retrieving app %s", appName)
+	}
+	return &app, nil
+}
+
+// revoke revokes the key, which remains on the app
+func (cr *credentials) revoke(key string) error {
+	keyPath := fmt.Sprintf(keyPathFormat, cr.developerEmail, appName, key) + "?action=revoke"
+	req, err := cr.Client.NewRequestNoEnvWithContext(cr.Context(), http.MethodPost, keyPath, nil)
+	if err != nil {
+		return err
+	}
+	_, err = cr.Client.Do(req, nil)
+	return err
+}
+
+// configKey returns the key of --config, if any
+func (cr *credentials) configKey() string {
+	if cr.ServerConfig == nil {
+		return ""
+	}
+	return cr.ServerConfig.Tenant.Key
+}
+
+// formatTime formats a time in milliseconds since the epoch
+func formatTime(ms string) string {
+	t := millis(ms)
+	if t <= 0 {
+		return "unknown"
+	}
+	return time.Unix(0, t*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+// millis parses a time in milliseconds since the epoch, 0 if invalid
+func millis(ms string) int64 {
+	t, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return t
+}
@@ -0,0 +1,317 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apigee/apigee-remote-service-cli/cmd"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-cli/testutil"
+	"github.com/apigee/apigee-remote-service-envoy/server"
+	"gopkg.in/yaml.v3"
+)
+
+const appPath = "/v1/organizations/org/developers/dev@example.com/apps/remote-service"
+
+// credentialsServer has an app with two approved keys and a revoked one
+func credentialsServer(calls *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			*calls = append(*calls, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == appPath:
+			w.Write([]byte(`{"name": "remote-service", "credentials": [
+				{"consumerKey": "current", "status": "approved", "issuedAt": "1600000000000"},
+				{"consumerKey": "stale", "status": "approved", "issuedAt": "1590000000000"},
+				{"consumerKey": "old", "status": "revoked", "issuedAt": "1580000000000"}
+			]}`))
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+}
+
+func TestCredentialsList(t *testing.T) {
+
+	print := testutil.Printer("TestCredentialsList")
+
+	var calls []string
+	ts := credentialsServer(&calls)
+	defer ts.Close()
+
+	flags := []string{"credentials", "list", "--management", ts.URL, "-t", "/token/",
+		"-o", "org", "-d", "dev@example.com"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	wants := []string{
+		"credentials of app remote-service of developer dev@example.com:",
+		"  current: approved, issued 2020-09-13T12:26:40Z",
+		"  stale: approved, issued 2020-05-20T18:40:00Z",
+		"  old: revoked, issued 2020-01-26T00:53:20Z",
+	}
+	print.Check(t, wants)
+}
+
+func TestCredentialsPrune(t *testing.T) {
+
+	print := testutil.Printer("TestCredentialsPrune")
+
+	var calls []string
+	ts := credentialsServer(&calls)
+	defer ts.Close()
+
+	flags := []string{"credentials", "prune", "--yes", "--keep", "current",
+		"--management", ts.URL, "-t", "/token/", "-o", "org", "-d", "dev@example.com"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	wantCalls := []string{
+		"POST " + appPath + "/keys/stale?action=revoke",
+	}
+	if !reflect.DeepEqual(wantCalls, calls) {
+		t.Errorf("want calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(calls, "\n"))
+	}
+
+	wants := []string{
+		"revoking 1 credential(s) of app remote-service will:",
+		"  revoke stale",
+		"credential stale revoked",
+	}
+	print.Check(t, wants)
+}
+
+func TestCredentialsPruneRequiresKeep(t *testing.T) {
+
+	print := testutil.Printer("TestCredentialsPruneRequiresKeep")
+
+	var calls []string
+	ts := credentialsServer(&calls)
+	defer ts.Close()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "--config or --keep is required"},
+		{[]string{"--keep", "missing"}, "1 of the kept keys are not credentials of app remote-service"},
+	}
+	for _, test := range tests {
+		flags := []string{"credentials", "prune", "--yes",
+			"--management", ts.URL, "-t", "/token/", "-o", "org", "-d", "dev@example.com"}
+		flags = append(flags, test.args...)
+		rootArgs := &shared.RootArgs{}
+		rootCmd := cmd.GetRootCmd(flags, print.Printf)
+		shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v want error %q, got: %v", test.args, test.want, err)
+		}
+	}
+	if len(calls) != 0 {
+		t.Errorf("want no changes, got: %v", calls)
+	}
+}
+
+func TestCredentialsRevoke(t *testing.T) {
+
+	print := testutil.Printer("TestCredentialsRevoke")
+
+	var calls []string
+	ts := credentialsServer(&calls)
+	defer ts.Close()
+
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"stale"}, ""},
+		{nil, "specify either a key or --old"},
+		{[]string{"stale", "--old"}, "specify either a key or --old"},
+		{[]string{"--old"}, "--old requires --config"},
+	}
+	for _, test := range tests {
+		flags := []string{"credentials", "revoke",
+			"--management", ts.URL, "-t", "/token/", "-o", "org", "-d", "dev@example.com"}
+		flags = append(flags, test.args...)
+		rootArgs := &shared.RootArgs{}
+		rootCmd := cmd.GetRootCmd(flags, print.Printf)
+		shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+		err := rootCmd.Execute()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%v want no error, got: %v", test.args, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%v want error %q, got: %v", test.args, test.wantErr, err)
+		}
+	}
+
+	wantCalls := []string{
+		"POST " + appPath + "/keys/stale?action=revoke",
+	}
+	if !reflect.DeepEqual(wantCalls, calls) {
+		t.Errorf("want calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(calls, "\n"))
+	}
+	print.Check(t, []string{"credential stale revoked"})
+}
+
+func TestCredentialsRevokeOld(t *testing.T) {
+
+	print := testutil.Printer("TestCredentialsRevokeOld")
+
+	var calls []string
+	app := `{"name": "remote-service", "credentials": [
+		{"consumerKey": "newer", "status": "approved", "issuedAt": "1610000000000"},
+		{"consumerKey": "current", "status": "approved", "issuedAt": "1600000000000"},
+		{"consumerKey": "stale", "status": "approved", "issuedAt": "1590000000000"},
+		{"consumerKey": "unknown", "status": "approved", "issuedAt": "invalid"},
+		{"consumerKey": "old", "status": "revoked", "issuedAt": "1580000000000"}
+	]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			calls = append(calls, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(app))
+	}))
+	defer ts.Close()
+
+	revokeOld := func(key string) error {
+		flags := []string{"credentials", "revoke", "--old",
+			"--management", ts.URL, "-t", "/token/", "-o", "org", "-d", "dev@example.com"}
+		config := &server.Config{}
+		config.Tenant.Key = key
+		rootArgs := &shared.RootArgs{ServerConfig: config}
+		rootCmd := cmd.GetRootCmd(flags, print.Printf)
+		shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+		return rootCmd.Execute()
+	}
+
+	// the key with an unknown issue time isn't revoked
+	if err := revokeOld("current"); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	wantCalls := []string{
+		"POST " + appPath + "/keys/stale?action=revoke",
+	}
+	if !reflect.DeepEqual(wantCalls, calls) {
+		t.Errorf("want calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(calls, "\n"))
+	}
+	print.Check(t, []string{
+		"credential stale revoked",
+		"credential unknown has an unknown issue time, skipping",
+	})
+
+	// nor any if the config's key has an unknown issue time
+	calls = nil
+	for key, want := range map[string]string{
+		"unknown": "key unknown of the config has an unknown issue time",
+		"missing": "key missing of the config is not a credential of app remote-service",
+	} {
+		if err := revokeOld(key); err == nil || err.Error() != want {
+			t.Errorf("want error %q, got: %v", want, err)
+		}
+	}
+	if len(calls) != 0 {
+		t.Errorf("want no changes, got: %v", calls)
+	}
+}
+
+func TestCredentialsRotateOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestCredentialsRotateOPDK")
+
+	var created map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/edgemicro/credential/organization/org/environment/env" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	configFile, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(configFile.Name())
+	fmt.Fprintf(configFile, `tenant:
+  internal_api: %[1]s/edgemicro
+  remote_service_api: %[1]s/remote-service
+  org_name: org
+  env_name: env
+  key: /oldkey/
+  secret: /oldsecret/
+`, ts.URL)
+	configFile.Close()
+
+	flags := []string{"credentials", "rotate", "-c", configFile.Name(),
+		"-u", "/username/", "-p", "password"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	if created["key"] == "" || created["key"] == "/oldkey/" || created["secret"] == "/oldsecret/" {
+		t.Fatalf("want new credential created, got: %v", created)
+	}
+	if len(print.Prints) != 3 || print.Prints[0] != "# Configuration for apigee-remote-service-envoy" ||
+		!strings.HasPrefix(print.Prints[1], "# generated by apigee-remote-service-cli credentials rotate on ") {
+		t.Fatalf("want config, got: %v", print.Prints)
+	}
+	var config server.Config
+	if err := yaml.Unmarshal([]byte(print.Prints[2]), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Tenant.Key != created["key"] || config.Tenant.Secret != created["secret"] {
+		t.Errorf("want config with new credential %v, got: %v", created, config.Tenant)
+	}
+	if config.Tenant.InternalAPI != ts.URL+"/edgemicro" || config.Tenant.OrgName != "org" || config.Tenant.EnvName != "env" {
+		t.Errorf("want config otherwise unchanged, got: %v", config.Tenant)
+	}
+}
@@ -0,0 +1,397 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deprovision
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+const (
+	removeServiceName = "remote-service" // proxy, kvm, cache, product and app
+	internalProxyName = "edgemicro-internal"
+
+	apiProductsPath        = "apiproducts"
+	developersPath         = "developers"
+	applicationsPathFormat = "developers/%s/apps"            // developer email
+	keyPathFormat          = "developers/%s/apps/%s/keys/%s" // developer email, app ID, key ID
+)
+
+type deprovision struct {
+	*shared.RootArgs
+	developerEmail string
+	deleteApp      bool
+	yes            bool
+	printf         shared.FormatFn
+
+	// the environments of the remote-service product other than this one,
+	// once retrieved
+	otherEnvs *[]string
+}
+
+// a step is a change that deprovision makes
+type step struct {
+	desc string
+	run  func() error
+}
+
+// Cmd returns base command
+func Cmd(rootArgs *shared.RootArgs, printf shared.FormatFn) *cobra.Command {
+	d := &deprovision{RootArgs: rootArgs, printf: printf}
+
+	c := &cobra.Command{
+		Use:   "deprovision",
+		Short: "Remove remote services from your Apigee environment",
+		Long: `The deprovision command removes what provision set up in your Apigee environment. This
+includes undeploying and deleting the remote-service proxies, deleting the remote-service kvm and cache,
+and deleting the credential of the --config file. A proxy that is still deployed to other environments is
+undeployed but not deleted. On hybrid, the environment is removed from the remote-service product. Use
+--delete-app to also delete the remote-service product, developer and app once the product has no other
+environments (hybrid only).`,
+		Args: cobra.NoArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := rootArgs.Resolve(false, true); err != nil {
+				return err
+			}
+			missingFlagNames := []string{}
+			if d.Org == "" {
+				missingFlagNames = append(missingFlagNames, "organization")
+			}
+			if d.Env == "" {
+				missingFlagNames = append(missingFlagNames, "environment")
+			}
+			if d.IsGCPManaged && d.developerEmail == "" {
+				missingFlagNames = append(missingFlagNames, "developer-email")
+			}
+			return d.PrintMissingFlags(missingFlagNames)
+		},
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cmd.SilenceUsage = true
+			return d.run(cmd.InOrStdin())
+		},
+	}
+
+	c.Flags().StringVarP(&rootArgs.ManagementBase, "management", "m",
+		shared.DefaultManagementBase, "Apigee management base URL")
+	c.Flags().BoolVarP(&rootArgs.IsLegacySaaS, "legacy", "", false,
+		"Apigee SaaS (sets management and runtime URL)")
+	c.Flags().BoolVarP(&rootArgs.IsOPDK, "opdk", "", false,
+		"Apigee opdk")
+
+	c.Flags().StringVarP(&rootArgs.Token, "token", "t", "",
+		"Apigee OAuth or SAML token (hybrid only)")
+	c.Flags().StringVarP(&rootArgs.ServiceAccount, "service-account", "", "",
+		"Google service account key file for OAuth tokens (hybrid only)")
+	c.Flags().BoolVarP(&rootArgs.UseADC, "adc", "", false,
+		"use Google Application Default Credentials for OAuth tokens (hybrid only)")
+	c.Flags().StringVarP(&rootArgs.Username, "username", "u", "",
+		"Apigee username (legacy or OPDK only)")
+	c.Flags().StringVarP(&rootArgs.Password, "password", "p", "",
+		"Apigee password (legacy or OPDK only)")
+
+	c.Flags().StringVarP(&d.developerEmail, "developer-email", "d", "",
+		"email of the developer used by provision (hybrid only)")
+	c.Flags().BoolVarP(&d.deleteApp, "delete-app", "", false,
+		"also delete the remote-service product, app and, if it has no other apps, developer when the product has no other environments (hybrid only)")
+	c.Flags().BoolVarP(&d.yes, "yes", "y", false,
+		"don't prompt for confirmation")
+
+	return c
+}
+
+func (d *deprovision) run(in io.Reader) error {
+	printf := d.printf
+	steps := d.steps()
+
+	printf("deprovisioning org %s env %s will:", d.Org, d.Env)
+	for _, s := range steps {
+		printf("  %s", s.desc)
+	}
+	if !d.IsGCPManaged {
+		printf("note: credentials created by provision for legacy SaaS or OPDK are not revoked")
+	} else if d.configKey() == "" {
+		printf("note: without --config the credential of env %s is unknown and is not deleted", d.Env)
+	}
+
+	if !d.yes && !shared.Confirm(in, printf) {
+		printf("deprovision cancelled")
+		return nil
+	}
+
+	var errs error
+	for _, s := range steps {
+		if err := s.run(); err != nil {
+			errs = multierr.Append(errs, errors.Wrapf(err, "unable to %s", s.desc))
+		}
+	}
+	if errs != nil {
+		for _, err := range multierr.Errors(errs) {
+			printf("%s", err)
+		}
+		return fmt.Errorf("deprovision incomplete, %d step(s) failed", len(multierr.Errors(errs)))
+	}
+
+	printf("deprovisioned org %s env %s", d.Org, d.Env)
+	return nil
+}
+
+// steps returns the changes to make for the Apigee flavor
+func (d *deprovision) steps() []step {
+	var steps []step
+
+	proxies := []string{removeServiceName}
+	if d.IsOPDK {
+		proxies = append(proxies, internalProxyName)
+	}
+	for _, name := range proxies {
+		name := name
+		steps = append(steps, step{
+			desc: fmt.Sprintf("undeploy proxy %s, and delete it if not deployed to other environments", name),
+			run:  func() error { return d.deleteProxy(name) },
+		})
+	}
+
+	if d.IsGCPManaged {
+		if key := d.configKey(); key != "" {
+			keyPath := fmt.Sprintf(keyPathFormat, d.developerEmail, removeServiceName, key)
+			steps = append(steps, step{
+				desc: fmt.Sprintf("delete the --config credential of app %s of developer %s", removeServiceName, d.developerEmail),
+				run:  func() error { return d.delete("credential", keyPath) },
+			})
+		}
+		steps = append(steps, step{
+			desc: fmt.Sprintf("remove env %s from product %s", d.Env, removeServiceName),
+			run:  d.removeProductEnvironment,
+		})
+		if d.deleteApp {
+			appPath := path.Join(fmt.Sprintf(applicationsPathFormat, d.developerEmail), removeServiceName)
+			steps = append(steps,
+				step{
+					desc: fmt.Sprintf("delete app %s of developer %s if the product has no other environments", removeServiceName, d.developerEmail),
+					run:  d.unlessShared("app", removeServiceName, func() error { return d.delete("app", appPath) }),
+				},
+				step{
+					desc: fmt.Sprintf("delete product %s if it has no other environments", removeServiceName),
+					run: d.unlessShared("product", removeServiceName, func() error {
+						return d.delete("product", path.Join(apiProductsPath, removeServiceName))
+					}),
+				},
+				step{
+					desc: fmt.Sprintf("delete developer %s if it has no other apps and the product has no other environments", d.developerEmail),
+					run:  d.unlessShared("developer", d.developerEmail, d.deleteDeveloper),
+				},
+			)
+		}
+		return steps
+	}
+
+	steps = append(steps,
+		step{
+			desc: fmt.Sprintf("delete kvm %s", removeServiceName),
+			run: func() error {
+				_, err := d.Client.KVMService.DeleteWithContext(d.Context(), removeServiceName)
+				return d.skipNotFound("kvm", removeServiceName, err)
+			},
+		},
+		step{
+			desc: fmt.Sprintf("delete cache %s", removeServiceName),
+			run: func() error {
+				_, err := d.Client.CacheService.DeleteWithContext(d.Context(), removeServiceName)
+				return d.skipNotFound("cache", removeServiceName, err)
+			},
+		},
+	)
+	return steps
+}
+
+// deleteProxy undeploys the proxy from the environment and deletes it,
+// unless it is deployed to other environments
+func (d *deprovision) deleteProxy(name string) error {
+	var rev *apigee.Revision
+	var err error
+	if d.IsGCPManaged {
+		rev, err = d.Client.Proxies.GetGCPDeployedRevisionWithContext(d.Context(), name)
+	} else {
+		rev, err = d.Client.Proxies.GetDeployedRevisionWithContext(d.Context(), name)
+	}
+	if err != nil {
+		return err
+	}
+	if rev != nil {
+		_, res, err := d.Client.Proxies.UndeployWithContext(d.Context(), name, d.Env, *rev)
+		if res != nil {
+			res.Body.Close()
+		}
+		if err != nil {
+			return err
+		}
+		d.printf("proxy %s revision %d undeployed from %s", name, *rev, d.Env)
+	}
+
+	envs, err := d.Client.Proxies.GetDeployedEnvironmentsWithContext(d.Context(), name)
+	if err != nil {
+		return err
+	}
+	var others []string
+	for _, env := range envs {
+		if env != d.Env {
+			others = append(others, env)
+		}
+	}
+	if len(others) > 0 {
+		d.printf("proxy %s is deployed to other environments (%s), not deleted", name, strings.Join(others, ", "))
+		return nil
+	}
+
+	_, res, err := d.Client.Proxies.DeleteWithContext(d.Context(), name)
+	if res != nil {
+		res.Body.Close()
+	}
+	return d.skipNotFound("proxy", name, err)
+}
+
+// delete deletes the management API resource at path
+func (d *deprovision) delete(kind, resourcePath string) error {
+	req, err := d.Client.NewRequestNoEnvWithContext(d.Context(), http.MethodDelete, resourcePath, nil)
+	if err != nil {
+		return err
+	}
+	_, err = d.Client.Do(req, nil)
+	return d.skipNotFound(kind, path.Base(resourcePath), err)
+}
+
+// skipNotFound reports a deleted resource, or one that was already gone
+func (d *deprovision) skipNotFound(kind, name string, err error) error {
+	if errors.Is(err, apigee.ErrNotFound) {
+		d.printf("%s %s not found, skipping", kind, name)
+		return nil
+	}
+	if err == nil {
+		d.printf("%s %s deleted", kind, name)
+	}
+	return err
+}
+
+// configKey returns the key of the credential in the --config file, if any
+func (d *deprovision) configKey() string {
+	if d.ServerConfig == nil {
+		return ""
+	}
+	return d.ServerConfig.Tenant.Key
+}
+
+// removeProductEnvironment removes the environment from the remote-service
+// product. The product is left as is if it has no other environments, as a
+// product without environments is available in all of them.
+func (d *deprovision) removeProductEnvironment() error {
+	productPath := path.Join(apiProductsPath, removeServiceName)
+	req, err := d.Client.NewRequestNoEnvWithContext(d.Context(), http.MethodGet, productPath, nil)
+	if err != nil {
+		return err
+	}
+	// a map, so that the update keeps the fields this doesn't know about
+	var product map[string]interface{}
+	if _, err = d.Client.Do(req, &product); err != nil {
+		if errors.Is(err, apigee.ErrNotFound) {
+			d.otherEnvs = &[]string{}
+			d.printf("product %s not found, skipping", removeServiceName)
+			return nil
+		}
+		return err
+	}
+
+	envs, _ := product["environments"].([]interface{})
+	others := []string{}
+	for _, env := range envs {
+		if env, ok := env.(string); ok && env != d.Env {
+			others = append(others, env)
+		}
+	}
+	d.otherEnvs = &others
+	switch {
+	case len(others) == 0:
+		d.printf("product %s has no other environments, not updated", removeServiceName)
+		return nil
+	case len(others) == len(envs):
+		d.printf("product %s is not for env %s, skipping", removeServiceName, d.Env)
+		return nil
+	}
+
+	product["environments"] = others
+	req, err = d.Client.NewRequestNoEnvWithContext(d.Context(), http.MethodPut, productPath, product)
+	if err != nil {
+		return err
+	}
+	if _, err = d.Client.Do(req, nil); err != nil {
+		return err
+	}
+	d.printf("env %s removed from product %s", d.Env, removeServiceName)
+	return nil
+}
+
+// unlessShared returns a step that runs del, unless the remote-service product
+// has environments other than this one. removeProductEnvironment must run first.
+func (d *deprovision) unlessShared(kind, name string, del func() error) func() error {
+	return func() error {
+		if d.otherEnvs == nil {
+			return fmt.Errorf("the environments of product %s are unknown", removeServiceName)
+		}
+		if others := *d.otherEnvs; len(others) > 0 {
+			d.printf("product %s is for other environments (%s), %s %s not deleted",
+				removeServiceName, strings.Join(others, ", "), kind, name)
+			return nil
+		}
+		return del()
+	}
+}
+
+// deleteDeveloper deletes the developer if it has no apps
+func (d *deprovision) deleteDeveloper() error {
+	appsPath := fmt.Sprintf(applicationsPathFormat, d.developerEmail) + "?expand=true"
+	req, err := d.Client.NewRequestNoEnvWithContext(d.Context(), http.MethodGet, appsPath, nil)
+	if err != nil {
+		return err
+	}
+	var apps developerApps
+	if _, err = d.Client.Do(req, &apps); err != nil {
+		return d.skipNotFound("developer", d.developerEmail, err)
+	}
+	if len(apps.Apps) > 0 {
+		names := make([]string, 0, len(apps.Apps))
+		for _, app := range apps.Apps {
+			names = append(names, app.Name)
+		}
+		d.printf("developer %s has other apps (%s), not deleted", d.developerEmail, strings.Join(names, ", "))
+		return nil
+	}
+	return d.delete("developer", path.Join(developersPath, d.developerEmail))
+}
+
+// developerApps is the hybrid list of a developer's apps
+type developerApps struct {
+	Apps []struct {
+		Name string `json:"name"`
+	} `json:"app"`
+}
@@ -0,0 +1,328 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deprovision
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apigee/apigee-remote-service-cli/cmd"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-cli/testutil"
+	"github.com/apigee/apigee-remote-service-envoy/server"
+)
+
+// deprovisionServer has remote-service deployed at revision 2, no
+// edgemicro-internal proxy and no cache
+func deprovisionServer(calls *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			*calls = append(*calls, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/organizations/org/environments/env/apis/remote-service/deployments":
+			w.Write([]byte(`{"name": "remote-service", "revision": [{"name": "2", "state": "deployed"}]}`))
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		case strings.Contains(r.URL.Path, "edgemicro-internal"), strings.Contains(r.URL.Path, "/caches/"):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+}
+
+func TestDeprovisionOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestDeprovisionOPDK")
+
+	var calls []string
+	ts := deprovisionServer(&calls)
+	defer ts.Close()
+
+	flags := []string{"deprovision", "--yes", "--opdk", "--runtime", ts.URL,
+		"-o", "org", "-e", "env", "-u", "/username/", "-p", "password"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	wantCalls := []string{
+		"POST /v1/organizations/org/apis/remote-service/revisions/2/deployments?action=undeploy&env=env",
+		"DELETE /v1/organizations/org/apis/remote-service?",
+		"DELETE /v1/organizations/org/apis/edgemicro-internal?",
+		"DELETE /v1/organizations/org/environments/env/keyvaluemaps/remote-service?",
+		"DELETE /v1/organizations/org/environments/env/caches/remote-service?",
+	}
+	if !reflect.DeepEqual(wantCalls, calls) {
+		t.Errorf("want calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(calls, "\n"))
+	}
+
+	wants := []string{
+		"deprovisioning org org env env will:",
+		"  undeploy proxy remote-service, and delete it if not deployed to other environments",
+		"  undeploy proxy edgemicro-internal, and delete it if not deployed to other environments",
+		"  delete kvm remote-service",
+		"  delete cache remote-service",
+		"note: credentials created by provision for legacy SaaS or OPDK are not revoked",
+		"proxy remote-service revision 2 undeployed from env",
+		"proxy remote-service deleted",
+		"proxy edgemicro-internal not found, skipping",
+		"kvm remote-service deleted",
+		"cache remote-service not found, skipping",
+		"deprovisioned org org env env",
+	}
+	print.Check(t, wants)
+}
+
+func TestDeprovisionCancelOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestDeprovisionCancelOPDK")
+
+	var calls []string
+	ts := deprovisionServer(&calls)
+	defer ts.Close()
+
+	flags := []string{"deprovision", "--opdk", "--runtime", ts.URL,
+		"-o", "org", "-e", "env", "-u", "/username/", "-p", "password"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	rootCmd.SetIn(strings.NewReader("n\n"))
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("want no changes, got: %v", calls)
+	}
+	if last := print.Prints[len(print.Prints)-1]; last != "deprovision cancelled" {
+		t.Errorf("want cancelled, got: %s", last)
+	}
+}
+
+// hybridDeprovisionServer has remote-service deployed at revision 2 to env
+// and to the envs of deployments, the developer has apps and there is the
+// remote-service product. It records the bodies of non-GET requests in bodies.
+func hybridDeprovisionServer(calls *[]string, bodies map[string]string, deployments, apps, product string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			call := r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+			*calls = append(*calls, call)
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies[call] = string(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/organizations/org/environments/env/apis/remote-service/deployments":
+			w.Write([]byte(`{"deployments": [{"environment": "env", "apiProxy": "remote-service", "revision": "2"}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/organizations/org/apis/remote-service/deployments":
+			w.Write([]byte(deployments))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/organizations/org/developers/dev@example.com/apps":
+			w.Write([]byte(apps))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/organizations/org/apiproducts/remote-service":
+			w.Write([]byte(product))
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+}
+
+func TestDeprovisionDeleteApp(t *testing.T) {
+
+	print := testutil.Printer("TestDeprovisionDeleteApp")
+
+	var calls []string
+	ts := hybridDeprovisionServer(&calls, map[string]string{},
+		`{"deployments": [{"environment": "env", "apiProxy": "remote-service", "revision": "2"}]}`, `{}`,
+		`{"name": "remote-service", "environments": ["env"]}`)
+	defer ts.Close()
+
+	flags := []string{"deprovision", "--yes", "--delete-app", "--management", ts.URL, "--runtime", "/runtime/",
+		"-o", "org", "-e", "env", "-t", "/token/", "-d", "dev@example.com"}
+	rootArgs := &shared.RootArgs{ServerConfig: configWithKey("0123abcd")}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	wantCalls := []string{
+		"DELETE /v1/organizations/org/environments/env/apis/remote-service/revisions/2/deployments?",
+		"DELETE /v1/organizations/org/apis/remote-service?",
+		"DELETE /v1/organizations/org/developers/dev@example.com/apps/remote-service/keys/0123abcd?",
+		"DELETE /v1/organizations/org/developers/dev@example.com/apps/remote-service?",
+		"DELETE /v1/organizations/org/apiproducts/remote-service?",
+		"DELETE /v1/organizations/org/developers/dev@example.com?",
+	}
+	if !reflect.DeepEqual(wantCalls, calls) {
+		t.Errorf("want calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(calls, "\n"))
+	}
+
+	wants := []string{
+		"deprovisioning org org env env will:",
+		"  undeploy proxy remote-service, and delete it if not deployed to other environments",
+		"  delete the --config credential of app remote-service of developer dev@example.com",
+		"  remove env env from product remote-service",
+		"  delete app remote-service of developer dev@example.com if the product has no other environments",
+		"  delete product remote-service if it has no other environments",
+		"  delete developer dev@example.com if it has no other apps and the product has no other environments",
+		"proxy remote-service revision 2 undeployed from env",
+		"proxy remote-service deleted",
+		"credential 0123abcd deleted",
+		"product remote-service has no other environments, not updated",
+		"app remote-service deleted",
+		"product remote-service deleted",
+		"developer dev@example.com deleted",
+		"deprovisioned org org env env",
+	}
+	print.Check(t, wants)
+}
+
+func TestDeprovisionKeepShared(t *testing.T) {
+
+	print := testutil.Printer("TestDeprovisionKeepShared")
+
+	// the proxy is deployed to another env, the product is for another env
+	var calls []string
+	bodies := map[string]string{}
+	ts := hybridDeprovisionServer(&calls, bodies,
+		`{"deployments": [{"environment": "env", "apiProxy": "remote-service", "revision": "2"}, `+
+			`{"environment": "other", "apiProxy": "remote-service", "revision": "2"}]}`, `{}`,
+		`{"name": "remote-service", "environments": ["env", "other"], "quota": "10"}`)
+	defer ts.Close()
+
+	flags := []string{"deprovision", "--yes", "--delete-app", "--management", ts.URL, "--runtime", "/runtime/",
+		"-o", "org", "-e", "env", "-t", "/token/", "-d", "dev@example.com"}
+	rootArgs := &shared.RootArgs{ServerConfig: configWithKey("0123abcd")}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	// only the key of this env is deleted
+	update := "PUT /v1/organizations/org/apiproducts/remote-service?"
+	wantCalls := []string{
+		"DELETE /v1/organizations/org/environments/env/apis/remote-service/revisions/2/deployments?",
+		"DELETE /v1/organizations/org/developers/dev@example.com/apps/remote-service/keys/0123abcd?",
+		update,
+	}
+	if !reflect.DeepEqual(wantCalls, calls) {
+		t.Errorf("want calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(calls, "\n"))
+	}
+
+	// the env is removed from the product, other fields are kept
+	var product map[string]interface{}
+	json.Unmarshal([]byte(bodies[update]), &product)
+	want := map[string]interface{}{
+		"name":         "remote-service",
+		"environments": []interface{}{"other"},
+		"quota":        "10",
+	}
+	if !reflect.DeepEqual(want, product) {
+		t.Errorf("want product %v, got: %v", want, product)
+	}
+
+	wants := []string{
+		"deprovisioning org org env env will:",
+		"  undeploy proxy remote-service, and delete it if not deployed to other environments",
+		"  delete the --config credential of app remote-service of developer dev@example.com",
+		"  remove env env from product remote-service",
+		"  delete app remote-service of developer dev@example.com if the product has no other environments",
+		"  delete product remote-service if it has no other environments",
+		"  delete developer dev@example.com if it has no other apps and the product has no other environments",
+		"proxy remote-service revision 2 undeployed from env",
+		"proxy remote-service is deployed to other environments (other), not deleted",
+		"credential 0123abcd deleted",
+		"env env removed from product remote-service",
+		"product remote-service is for other environments (other), app remote-service not deleted",
+		"product remote-service is for other environments (other), product remote-service not deleted",
+		"product remote-service is for other environments (other), developer dev@example.com not deleted",
+		"deprovisioned org org env env",
+	}
+	print.Check(t, wants)
+}
+
+func TestDeprovisionKeepDeveloper(t *testing.T) {
+
+	print := testutil.Printer("TestDeprovisionKeepDeveloper")
+
+	// the developer has another app, there's no --config
+	var calls []string
+	ts := hybridDeprovisionServer(&calls, map[string]string{},
+		`{"deployments": [{"environment": "env", "apiProxy": "remote-service", "revision": "2"}]}`,
+		`{"app": [{"appId": "8a7f6e5d", "name": "other-app"}]}`,
+		`{"name": "remote-service", "environments": ["env"]}`)
+	defer ts.Close()
+
+	flags := []string{"deprovision", "--yes", "--delete-app", "--management", ts.URL, "--runtime", "/runtime/",
+		"-o", "org", "-e", "env", "-t", "/token/", "-d", "dev@example.com"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	wantCalls := []string{
+		"DELETE /v1/organizations/org/environments/env/apis/remote-service/revisions/2/deployments?",
+		"DELETE /v1/organizations/org/apis/remote-service?",
+		"DELETE /v1/organizations/org/developers/dev@example.com/apps/remote-service?",
+		"DELETE /v1/organizations/org/apiproducts/remote-service?",
+	}
+	if !reflect.DeepEqual(wantCalls, calls) {
+		t.Errorf("want calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(calls, "\n"))
+	}
+
+	wants := []string{
+		"deprovisioning org org env env will:",
+		"  undeploy proxy remote-service, and delete it if not deployed to other environments",
+		"  remove env env from product remote-service",
+		"  delete app remote-service of developer dev@example.com if the product has no other environments",
+		"  delete product remote-service if it has no other environments",
+		"  delete developer dev@example.com if it has no other apps and the product has no other environments",
+		"note: without --config the credential of env env is unknown and is not deleted",
+		"proxy remote-service revision 2 undeployed from env",
+		"proxy remote-service deleted",
+		"product remote-service has no other environments, not updated",
+		"app remote-service deleted",
+		"product remote-service deleted",
+		"developer dev@example.com has other apps (other-app), not deleted",
+		"deprovisioned org org env env",
+	}
+	print.Check(t, wants)
+}
+
+// configWithKey returns a config with the credential key, as loaded from --config
+func configWithKey(key string) *server.Config {
+	config := &server.Config{}
+	config.Tenant.Key = key
+	return config
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login
+
+import (
+	"net/http"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type login struct {
+	*shared.RootArgs
+	options apigee.LoginOptions
+}
+
+// Cmd returns base command
+func Cmd(rootArgs *shared.RootArgs, printf shared.FormatFn) *cobra.Command {
+	l := &login{RootArgs: rootArgs}
+
+	c := &cobra.Command{
+		Use:   "login",
+		Short: "Log in to Apigee SaaS",
+		Long: `Log in to Apigee SaaS (legacy) using OAuth2, with an MFA code or SSO passcode
+if required. The access and refresh tokens are cached and used by other commands
+when --username and --password are not specified.`,
+		Args: cobra.NoArgs,
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cmd.SilenceUsage = true
+			return l.login(printf)
+		},
+	}
+
+	c.Flags().StringVarP(&l.options.Username, "username", "u", "",
+		"Apigee username")
+	c.Flags().StringVarP(&l.options.Password, "password", "p", "",
+		"Apigee password")
+	c.Flags().StringVarP(&l.options.MFACode, "mfa", "", "",
+		"multi-factor authentication code")
+	c.Flags().StringVarP(&l.options.Passcode, "passcode", "", "",
+		"SSO one-time passcode (instead of --username and --password)")
+	c.Flags().StringVarP(&l.options.LoginURL, "login-url", "", apigee.DefaultLoginURL,
+		"Apigee OAuth2 token URL (eg. for an SSO zone)")
+
+	return c
+}
+
+func (l *login) login(printf shared.FormatFn) error {
+	client := &http.Client{Timeout: l.Timeout}
+	token, err := apigee.Login(l.Context(), client, l.options)
+	if err != nil {
+		return errors.Wrap(err, "logging in")
+	}
+	tokenFile := apigee.DefaultTokenCachePath()
+	if err := apigee.SaveOAuthToken(tokenFile, token); err != nil {
+		return errors.Wrap(err, "caching tokens")
+	}
+	printf("logged in, tokens cached in %s", tokenFile)
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/cmd"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-cli/testutil"
+)
+
+func TestLogin(t *testing.T) {
+
+	print := testutil.Printer("TestLogin")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "edgecli" || pass != "edgeclisecret" {
+			t.Errorf("want edgecli client credentials, got: %s", r.Header.Get("Authorization"))
+		}
+		if got := r.URL.Query().Get("mfa_token"); got != "123456" {
+			t.Errorf("want mfa_token 123456, got: %s", got)
+		}
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "password" ||
+			r.PostForm.Get("username") != "/username/" ||
+			r.PostForm.Get("password") != "password" {
+			t.Errorf("unexpected login form: %v", r.PostForm)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "/access/", "refresh_token": "/refresh/", "expires_in": 1799}`))
+	}))
+	defer ts.Close()
+
+	home, err := ioutil.TempDir("", "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	flags := []string{"login", "-u", "/username/", "-p", "password", "--mfa", "123456",
+		"--login-url", ts.URL + "/oauth/token"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	tokenFile := apigee.DefaultTokenCachePath()
+	print.Check(t, []string{fmt.Sprintf("logged in, tokens cached in %s", tokenFile)})
+
+	fi, err := os.Stat(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("want token file mode 0600, got: %v", fi.Mode().Perm())
+	}
+
+	token, err := apigee.LoadOAuthToken(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "/access/" || token.RefreshToken != "/refresh/" {
+		t.Errorf("unexpected cached token: %#v", token)
+	}
+	if token.LoginURL != ts.URL+"/oauth/token" {
+		t.Errorf("want login url %s, got: %s", ts.URL+"/oauth/token", token.LoginURL)
+	}
+}
+
+func TestLoginRequiresCredentials(t *testing.T) {
+
+	print := testutil.Printer("TestLoginRequiresCredentials")
+
+	flags := []string{"login", "-u", "/username/"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err == nil {
+		t.Errorf("want error without password")
+	}
+}
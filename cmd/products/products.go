@@ -0,0 +1,261 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package products
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	productsPath = "apiproducts"
+
+	defaultApprovalType  = "auto"
+	defaultQuotaInterval = "1"
+	defaultQuotaTimeUnit = "minute"
+)
+
+type products struct {
+	*shared.RootArgs
+	options Options
+}
+
+// Options holds the API Product settings that may be specified by flag
+type Options struct {
+	DisplayName   string
+	Description   string
+	ApprovalType  string
+	Paths         []string
+	Scopes        []string
+	Environments  []string
+	Proxies       []string
+	Quota         string
+	QuotaInterval string
+	QuotaTimeUnit string
+}
+
+// AddFlags registers the product flags on the flag set
+func (o *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.DisplayName, "display-name", "", "",
+		"product display name (default: product name)")
+	flags.StringVarP(&o.Description, "description", "", "",
+		"product description")
+	flags.StringVarP(&o.ApprovalType, "approval-type", "", defaultApprovalType,
+		"product key approval type: auto or manual")
+	flags.StringSliceVarP(&o.Paths, "paths", "", nil,
+		"comma-separated resource paths (eg. /,/v1/**)")
+	flags.StringSliceVarP(&o.Scopes, "scopes", "", nil,
+		"comma-separated OAuth scopes")
+	flags.StringSliceVarP(&o.Environments, "environments", "", nil,
+		"comma-separated environments (default: --environment)")
+	flags.StringSliceVarP(&o.Proxies, "proxies", "", nil,
+		"comma-separated API proxies")
+	flags.StringVarP(&o.Quota, "quota", "", "",
+		"quota limit, number of requests per interval")
+	flags.StringVarP(&o.QuotaInterval, "quota-interval", "", defaultQuotaInterval,
+		"quota interval")
+	flags.StringVarP(&o.QuotaTimeUnit, "quota-unit", "", defaultQuotaTimeUnit,
+		"quota time unit: minute, hour, day, or month")
+}
+
+// NewProduct returns a new Product from the Options. If no environments
+// are specified, env is used.
+func (o *Options) NewProduct(name, env string) apigee.Product {
+	p := apigee.Product{
+		Name:         name,
+		DisplayName:  o.DisplayName,
+		Description:  o.Description,
+		ApprovalType: o.ApprovalType,
+		APIResources: o.Paths,
+		Environments: o.Environments,
+		Proxies:      o.Proxies,
+		Scopes:       o.Scopes,
+	}
+	if p.DisplayName == "" {
+		p.DisplayName = name
+	}
+	if p.ApprovalType == "" {
+		p.ApprovalType = defaultApprovalType
+	}
+	if len(p.Environments) == 0 && env != "" {
+		p.Environments = []string{env}
+	}
+	if o.Quota != "" {
+		p.Quota = o.Quota
+		p.QuotaInterval = o.QuotaInterval
+		p.QuotaTimeUnit = o.QuotaTimeUnit
+	}
+	return p
+}
+
+// Update applies the Options that were explicitly set on flags to the
+// product, as retrieved. Other fields, including those that aren't known
+// here, are kept.
+func (o *Options) Update(product map[string]interface{}, flags *pflag.FlagSet) {
+	set := func(flag, field string, value interface{}) {
+		if flags.Changed(flag) {
+			product[field] = value
+		}
+	}
+	set("display-name", "displayName", o.DisplayName)
+	set("description", "description", o.Description)
+	set("approval-type", "approvalType", o.ApprovalType)
+	set("paths", "apiResources", o.Paths)
+	set("scopes", "scopes", o.Scopes)
+	set("environments", "environments", o.Environments)
+	set("proxies", "proxies", o.Proxies)
+	set("quota", "quota", o.Quota)
+	if flags.Changed("quota-interval") || (flags.Changed("quota") && stringField(product, "quotaInterval") == "") {
+		product["quotaInterval"] = o.QuotaInterval
+	}
+	if flags.Changed("quota-unit") || (flags.Changed("quota") && stringField(product, "quotaTimeUnit") == "") {
+		product["quotaTimeUnit"] = o.QuotaTimeUnit
+	}
+}
+
+// stringField returns the string value of a field of a product, or "" if
+// it's not set
+func stringField(product map[string]interface{}, field string) string {
+	value, _ := product[field].(string)
+	return value
+}
+
+// Cmd returns base command
+func Cmd(rootArgs *shared.RootArgs, printf shared.FormatFn) *cobra.Command {
+	cfg := &products{RootArgs: rootArgs}
+
+	c := &cobra.Command{
+		Use:   "products",
+		Short: "Manage Apigee Products",
+		Long:  "Manage Apigee Products.",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return rootArgs.Resolve(false, true)
+		},
+	}
+
+	c.PersistentFlags().BoolVarP(&rootArgs.IsLegacySaaS, "legacy", "", false,
+		"Apigee SaaS (sets management and runtime URL)")
+	c.PersistentFlags().BoolVarP(&rootArgs.IsOPDK, "opdk", "", false,
+		"Apigee opdk")
+	c.PersistentFlags().StringVarP(&rootArgs.Token, "token", "t", "",
+		"Apigee OAuth or SAML token (hybrid only)")
+	c.PersistentFlags().StringVarP(&rootArgs.ServiceAccount, "service-account", "", "",
+		"Google service account key file for OAuth tokens (hybrid only)")
+	c.PersistentFlags().BoolVarP(&rootArgs.UseADC, "adc", "", false,
+		"use Google Application Default Credentials for OAuth tokens (hybrid only)")
+	c.PersistentFlags().StringVarP(&rootArgs.Username, "username", "u", "",
+		"Apigee username (legacy or OPDK only)")
+	c.PersistentFlags().StringVarP(&rootArgs.Password, "password", "p", "",
+		"Apigee password (legacy or OPDK only)")
+
+	c.AddCommand(cmdProductsCreate(cfg, printf))
+	c.AddCommand(cmdProductsUpdate(cfg, printf))
+	c.AddCommand(cmdProductsDelete(cfg, printf))
+
+	return c
+}
+
+func cmdProductsCreate(p *products, printf shared.FormatFn) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "create [product name]",
+		Short: "Create an Apigee Product",
+		Long:  "Create an Apigee Product",
+		Args:  cobra.ExactArgs(1),
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			product := p.options.NewProduct(args[0], p.Env)
+			if _, _, err := p.Client.Products.CreateWithContext(p.Context(), product); err != nil {
+				return errors.Wrapf(err, "creating product %s", product.Name)
+			}
+			printf("product %s created", product.Name)
+			return nil
+		},
+	}
+
+	p.options.AddFlags(c.Flags())
+
+	return c
+}
+
+func cmdProductsUpdate(p *products, printf shared.FormatFn) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "update [product name]",
+		Short: "Update an Apigee Product",
+		Long:  "Update an Apigee Product. Only the specified flags are changed.",
+		Args:  cobra.ExactArgs(1),
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			name := args[0]
+			// the product is updated as retrieved, so fields that aren't
+			// known here are kept
+			productPath := path.Join(productsPath, name)
+			req, err := p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodGet, productPath, nil)
+			if err != nil {
+				return err
+			}
+			var product map[string]interface{}
+			if _, err := p.Client.Do(req, &product); err != nil {
+				return errors.Wrapf(err, "retrieving product %s", name)
+			}
+			p.options.Update(product, cmd.Flags())
+			if stringField(product, "quota") != "" &&
+				(stringField(product, "quotaInterval") == "" || stringField(product, "quotaTimeUnit") == "") {
+				return fmt.Errorf("quota requires --quota-interval and --quota-unit")
+			}
+			if req, err = p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodPut, productPath, product); err != nil {
+				return err
+			}
+			if _, err := p.Client.Do(req, nil); err != nil {
+				return errors.Wrapf(err, "updating product %s", name)
+			}
+			printf("product %s updated", name)
+			return nil
+		},
+	}
+
+	p.options.AddFlags(c.Flags())
+
+	return c
+}
+
+func cmdProductsDelete(p *products, printf shared.FormatFn) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "delete [product name]",
+		Short: "Delete an Apigee Product",
+		Long:  "Delete an Apigee Product",
+		Args:  cobra.ExactArgs(1),
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			name := args[0]
+			if _, err := p.Client.Products.DeleteWithContext(p.Context(), name); err != nil {
+				return errors.Wrapf(err, "deleting product %s", name)
+			}
+			printf("product %s deleted", name)
+			return nil
+		},
+	}
+
+	return c
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package products
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/cmd"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-cli/testutil"
+	"github.com/spf13/cobra"
+)
+
+func TestProductsOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestProductsOPDK")
+	stored := map[string]apigee.Product{}
+	var methods []string
+	ts := productsTestServer(stored, &methods)
+	defer ts.Close()
+
+	var err error
+	var flags []string
+	var rootCmd *cobra.Command
+	var rootArgs *shared.RootArgs
+	var wants []string
+
+	// create
+	flags = []string{"products", "create", "prod", "--paths", "/,/v1/**", "--scopes", "read",
+		"--quota", "10", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{"product prod created"}
+	print.Check(t, wants)
+
+	want := apigee.Product{
+		Name:          "prod",
+		DisplayName:   "prod",
+		ApprovalType:  "auto",
+		APIResources:  []string{"/", "/v1/**"},
+		Environments:  []string{"/env/"},
+		Scopes:        []string{"read"},
+		Quota:         "10",
+		QuotaInterval: "1",
+		QuotaTimeUnit: "minute",
+	}
+	if got := stored["prod"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("want created %v, got: %v", want, got)
+	}
+
+	// update only changes specified flags
+	flags = []string{"products", "update", "prod", "--quota", "20", "--quota-unit", "hour",
+		"--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{"product prod updated"}
+	print.Check(t, wants)
+
+	want.Quota = "20"
+	want.QuotaTimeUnit = "hour"
+	if got := stored["prod"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("want updated %v, got: %v", want, got)
+	}
+
+	// update missing product
+	flags = []string{"products", "update", "missing", "--quota", "20",
+		"--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err == nil || !strings.HasPrefix(err.Error(), "retrieving product missing") {
+		t.Errorf("want retrieving product error, got: %v", err)
+	}
+	print.Check(t, nil)
+
+	// delete
+	flags = []string{"products", "delete", "prod", "--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs = &shared.RootArgs{}
+	rootCmd = cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err = rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	wants = []string{"product prod deleted"}
+	print.Check(t, wants)
+
+	if _, ok := stored["prod"]; ok {
+		t.Errorf("want prod deleted, got: %v", stored)
+	}
+
+	wantMethods := []string{"POST", "GET", "PUT", "GET", "DELETE"}
+	if !reflect.DeepEqual(methods, wantMethods) {
+		t.Errorf("want methods %v, got: %v", wantMethods, methods)
+	}
+}
+
+// productsTestServer stores products by name and records request methods
+func productsTestServer(stored map[string]apigee.Product, methods *[]string) *httptest.Server {
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*methods = append(*methods, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			var p apigee.Product
+			json.NewDecoder(r.Body).Decode(&p)
+			stored[p.Name] = p
+			json.NewEncoder(w).Encode(p)
+		case http.MethodGet:
+			p, ok := stored[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(p)
+		case http.MethodDelete:
+			delete(stored, name)
+		}
+	}))
+}
+
+func TestProductsUpdateKeepsFieldsOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestProductsUpdateKeepsFieldsOPDK")
+
+	// fields that aren't known to the cli, such as attributes and
+	// operationGroup, must be kept
+	current := `{
+		"name": "prod",
+		"displayName": "Prod",
+		"apiResources": ["/"],
+		"attributes": [{"name": "access", "value": "public"}],
+		"operationGroup": {"operationConfigs": [{"apiSource": "proxy"}]},
+		"quota": "10",
+		"quotaInterval": "1",
+		"quotaTimeUnit": "minute"
+	}`
+	var updated map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPut {
+			json.NewDecoder(r.Body).Decode(&updated)
+		}
+		w.Write([]byte(current))
+	}))
+	defer ts.Close()
+
+	flags := []string{"products", "update", "prod", "--scopes", "read,write", "--description", "",
+		"--opdk", "--runtime", ts.URL,
+		"-o", "/org/", "-e", "/env/", "-u", "/username/", "-p", "password"}
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	if err := rootCmd.Execute(); err != nil {
+		t.Errorf("want no error, got: %v", err)
+	}
+	print.Check(t, []string{"product prod updated"})
+
+	var want map[string]interface{}
+	json.Unmarshal([]byte(current), &want)
+	want["scopes"] = []interface{}{"read", "write"}
+	want["description"] = ""
+	if !reflect.DeepEqual(want, updated) {
+		t.Errorf("want updated %v, got: %v", want, updated)
+	}
+}
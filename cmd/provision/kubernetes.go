@@ -0,0 +1,423 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	emitKubernetes = "kubernetes"
+
+	adapterName                = "apigee-remote-service-envoy"
+	defaultAdapterImage        = "google/apigee-envoy-adapter:latest"
+	defaultKubernetesNamespace = "apigee"
+	analyticsTLSSecretFormat   = "apigee-udca-%s-%s-tls" // org, env
+
+	policySecretNameFormat = "%s-%s-policy-secret" // org, env
+
+	// hybrid forces specific file extensions! https://docs.apigee.com/hybrid/v1.2/k8s-secrets
+	jwksSecretKey       = "remote-service.crt" // obviously not a .crt, but hybrid will treat as blob
+	keySecretKey        = "remote-service.key"
+	kidSecretKey        = "remote-service.properties"
+	kidSecretPropFormat = "kid=%s" // KID
+)
+
+// NewPolicySecret returns a Secret with a new key for the JWT policy of the
+// hybrid remote-service proxy. If truncate is more than 1, the existing
+// certificates are retrieved from jwksURL and the newest truncate are kept.
+func NewPolicySecret(ctx context.Context, client *apigee.EdgeClient, org, env, namespace, jwksURL string,
+	truncate int, verbosef shared.FormatFn) (shared.KubernetesCRD, error) {
+	jwkSet := &jwk.Set{}
+	if truncate > 1 { // if 1, just skip old stuff
+		verbosef("retrieving existing certificates...")
+		var err error
+		if jwkSet, err = fetchJWKS(ctx, client, jwksURL); err != nil {
+			return shared.KubernetesCRD{}, err
+		}
+		jwksBytes, err := json.Marshal(jwkSet)
+		if err != nil {
+			return shared.KubernetesCRD{}, errors.Wrap(err, "marshalling JSON")
+		}
+		verbosef("old jkws...\n%s", string(jwksBytes))
+	}
+	return newPolicySecret(jwkSet, org, env, namespace, truncate, verbosef)
+}
+
+// fetchJWKS retrieves the certificates of the remote-service proxy
+func fetchJWKS(ctx context.Context, client *apigee.EdgeClient, jwksURL string) (*jwk.Set, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	var body bytes.Buffer
+	if _, err := client.Do(req, &body); err != nil {
+		return nil, errors.Wrap(err, "fetching jwks")
+	}
+	jwkSet, err := jwk.ParseBytes(body.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing jwks")
+	}
+	return jwkSet, nil
+}
+
+// newPolicySecret returns a Secret with a new key added to jwkSet
+func newPolicySecret(jwkSet *jwk.Set, org, env, namespace string, truncate int, verbosef shared.FormatFn) (shared.KubernetesCRD, error) {
+	keyID := time.Now().Format(time.RFC3339)
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return shared.KubernetesCRD{}, errors.Wrap(err, "generating key")
+	}
+
+	// jwks
+	key, err := jwk.New(&privateKey.PublicKey)
+	if err != nil {
+		return shared.KubernetesCRD{}, errors.Wrap(err, "generating jwks")
+	}
+	key.Set(jwk.KeyIDKey, keyID)
+	key.Set(jwk.AlgorithmKey, jwa.RS256.String())
+
+	jwkSet.Keys = append(jwkSet.Keys, key)
+
+	// sort increasing and truncate
+	sort.Sort(sort.Reverse(byKID(jwkSet.Keys)))
+	if truncate > 0 && len(jwkSet.Keys) > truncate {
+		jwkSet.Keys = jwkSet.Keys[:truncate]
+	}
+
+	jwksBytes, err := json.Marshal(jwkSet)
+	if err != nil {
+		return shared.KubernetesCRD{}, errors.Wrap(err, "marshalling JSON")
+	}
+	verbosef("new jkws...\n%s", string(jwksBytes))
+
+	// private key
+	keyBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	// kid
+	kidProp := fmt.Sprintf(kidSecretPropFormat, keyID)
+
+	// Secret CRD
+	data := map[string]string{
+		jwksSecretKey: base64.StdEncoding.EncodeToString(jwksBytes),
+		keySecretKey:  base64.StdEncoding.EncodeToString(keyBytes),
+		kidSecretKey:  base64.StdEncoding.EncodeToString([]byte(kidProp)),
+	}
+
+	return shared.KubernetesCRD{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Type:       "Opaque",
+		Metadata: shared.Metadata{
+			Name:      fmt.Sprintf(policySecretNameFormat, org, env),
+			Namespace: namespace,
+		},
+		Data: data,
+	}, nil
+}
+
+// printKubernetes is called by `provision --emit kubernetes`. It prints a
+// manifest to deploy apigee-remote-service-envoy for the current environment:
+// the config ConfigMap, the JWT policy Secret (hybrid only), and a
+// ServiceAccount, Deployment and Service.
+func (p *provision) printKubernetes(cred *credential, printf shared.FormatFn, verifyErrors error) error {
+	_, resources, workloadYAML, err := p.kubernetesResources(cred)
+	if err != nil {
+		return err
+	}
+
+	var docs []string
+	for _, r := range resources {
+		doc, err := encodeYAML(r)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+	docs = append(docs, workloadYAML)
+
+	printf("# Kubernetes manifest for apigee-remote-service-envoy")
+	printf("# generated by apigee-remote-service-cli provision on %s", time.Now().Format("2006-01-02 15:04:05"))
+	if verifyErrors != nil {
+		printf("# WARNING: verification of provision failed. May not be valid.")
+	}
+	printf("%s", strings.Join(docs, "---\n"))
+	return nil
+}
+
+// collectResources is called for `provision --emit helm` or `--emit kustomize`.
+// The resources of all environments are emitted together by emitResources.
+func (p *provision) collectResources(cred *credential, _ shared.FormatFn, _ error) error {
+	w, resources, workloadYAML, err := p.kubernetesResources(cred)
+	if err != nil {
+		return err
+	}
+	p.resources = append(p.resources, resources...)
+	p.workloads = append(p.workloads, namedDoc{name: w.Name, doc: workloadYAML})
+	return nil
+}
+
+// emitResources prints the collected resources as Helm values, or writes
+// them as a Kustomize base to the output dir
+func (p *provision) emitResources(printf shared.FormatFn) error {
+	if p.emit == shared.EmitHelm {
+		return shared.PrintHelmValues(p.resources, "provision", printf)
+	}
+
+	files := map[string]string{}
+	for _, r := range p.resources {
+		doc, err := encodeYAML(r)
+		if err != nil {
+			return err
+		}
+		files[shared.KustomizeFileName(r.Kind, r.Metadata.Name)] = doc
+	}
+	for _, w := range p.workloads {
+		files[shared.KustomizeFileName("workload", w.name)] = w.doc
+	}
+	if err := shared.WriteKustomizeBase(p.outputDir, files); err != nil {
+		return errors.Wrapf(err, "writing kustomize base to %s", p.outputDir)
+	}
+	printf("kustomize base written to %s", p.outputDir)
+	return nil
+}
+
+type namedDoc struct {
+	name string
+	doc  string
+}
+
+// kubernetesResources returns what's needed to deploy apigee-remote-service-envoy
+// for the current environment: the config ConfigMap and JWT policy Secret
+// (hybrid only, if the proxy has no key yet) resources, and a manifest of the
+// workload
+func (p *provision) kubernetesResources(cred *credential) (workload, []shared.KubernetesCRD, string, error) {
+	w := p.newWorkload()
+
+	configYAML, err := encodeYAML(p.newConfig(cred))
+	if err != nil {
+		return w, nil, "", err
+	}
+	resources := []shared.KubernetesCRD{{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   w.metadata(),
+		Data:       map[string]string{"config.yaml": configYAML},
+	}}
+
+	if p.IsGCPManaged {
+		jwksURL := fmt.Sprintf(certsURLFormat, p.RemoteServiceProxyURL)
+		secretName := fmt.Sprintf(policySecretNameFormat, p.Org, p.Env)
+		// the config is already provisioned, so don't fail if the existing
+		// certificates can't be retrieved: the Secret will have only a new key
+		jwkSet, err := fetchJWKS(p.Context(), p.Client, jwksURL)
+		if err != nil {
+			shared.Errorf("WARNING: unable to retrieve existing certificates, the policy secret has only a new key: %v", err)
+			jwkSet = &jwk.Set{}
+		}
+		if len(jwkSet.Keys) > 0 {
+			// the proxy already has the key of a policy Secret, keep using it
+			shared.Errorf("policy secret %s already exists and is not included, rotate its key with: token create-secret", secretName)
+		} else {
+			secret, err := newPolicySecret(jwkSet, p.Org, p.Env, w.Namespace, 2, shared.NoPrintf)
+			if err != nil {
+				return w, nil, "", errors.Wrap(err, "creating policy secret")
+			}
+			secret.Metadata.Labels = w.Labels
+			resources = append(resources, secret)
+		}
+	}
+
+	var workloadYAML bytes.Buffer
+	tmp := template.New("workload")
+	tmp.Funcs(template.FuncMap{"labels": indentLabels})
+	tmp, err = tmp.Parse(workloadTemplate)
+	if err != nil {
+		return w, nil, "", errors.Wrap(err, "creating template")
+	}
+	if err := tmp.Execute(&workloadYAML, w); err != nil {
+		return w, nil, "", errors.Wrap(err, "executing template")
+	}
+
+	return w, resources, strings.TrimPrefix(workloadYAML.String(), "\n"), nil
+}
+
+// workload names and labels the Kubernetes resources of an environment
+type workload struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	Image     string
+	TLSSecret string // analytics client certificate, hybrid only
+}
+
+func (p *provision) newWorkload() workload {
+	w := workload{
+		Name:      fmt.Sprintf("%s-%s-%s", adapterName, p.Org, p.Env),
+		Namespace: p.namespace,
+		Labels: map[string]string{
+			"app": adapterName,
+			"org": p.Org,
+			"env": p.Env,
+		},
+		Image: p.image,
+	}
+	if w.Namespace == "" {
+		w.Namespace = defaultKubernetesNamespace
+	}
+	if p.IsGCPManaged {
+		w.TLSSecret = fmt.Sprintf(analyticsTLSSecretFormat, p.Org, p.Env)
+	}
+	return w
+}
+
+func (w workload) metadata() shared.Metadata {
+	return shared.Metadata{
+		Name:      w.Name,
+		Namespace: w.Namespace,
+		Labels:    w.Labels,
+	}
+}
+
+// indentLabels formats labels as YAML lines indented by indent spaces
+func indentLabels(indent int, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n%s%s: %s", strings.Repeat(" ", indent), name, labels[name])
+	}
+	return b.String()
+}
+
+func encodeYAML(v interface{}) (string, error) {
+	var yamlBuffer bytes.Buffer
+	yamlEncoder := yaml.NewEncoder(&yamlBuffer)
+	yamlEncoder.SetIndent(2)
+	if err := yamlEncoder.Encode(v); err != nil {
+		return "", errors.Wrap(err, "encoding YAML")
+	}
+	return yamlBuffer.String(), nil
+}
+
+type byKID []jwk.Key
+
+func (a byKID) Len() int           { return len(a) }
+func (a byKID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byKID) Less(i, j int) bool { return a[i].KeyID() < a[j].KeyID() }
+
+const workloadTemplate = `
+{{- define "metadata"}}
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:{{labels 4 .Labels}}
+{{- end}}
+apiVersion: v1
+kind: ServiceAccount
+{{- template "metadata" .}}
+---
+apiVersion: apps/v1
+kind: Deployment
+{{- template "metadata" .}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:{{labels 6 .Labels}}
+  template:
+    metadata:
+      labels:{{labels 8 .Labels}}
+    spec:
+      serviceAccountName: {{.Name}}
+      containers:
+      - name: apigee-remote-service-envoy
+        image: "{{.Image}}"
+        imagePullPolicy: IfNotPresent
+        args:
+        - --config=/config/config.yaml
+        ports:
+        - name: grpc
+          containerPort: 5000
+        - name: metrics
+          containerPort: 5001
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: 5001
+        readinessProbe:
+          httpGet:
+            path: /healthz
+            port: 5001
+        resources:
+          requests:
+            cpu: 10m
+            memory: 100Mi
+          limits:
+            cpu: 100m
+            memory: 100Mi
+        volumeMounts:
+        - name: config
+          mountPath: /config
+          readOnly: true
+        {{- if .TLSSecret}}
+        - name: tls
+          mountPath: /opt/apigee/tls
+          readOnly: true
+        {{- end}}
+      volumes:
+      - name: config
+        configMap:
+          name: {{.Name}}
+      {{- if .TLSSecret}}
+      - name: tls
+        secret:
+          secretName: {{.TLSSecret}}
+      {{- end}}
+---
+apiVersion: v1
+kind: Service
+{{- template "metadata" .}}
+spec:
+  selector:{{labels 4 .Labels}}
+  ports:
+  - name: grpc
+    port: 5000
+    targetPort: grpc
+`
@@ -0,0 +1,261 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-cli/testutil"
+	"github.com/lestrrat-go/jwx/jwk"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestResources decodes the resources of the emitted manifest
+func manifestResources(t *testing.T, print *testutil.TestPrint) []shared.KubernetesCRD {
+	for _, p := range print.Prints {
+		if !strings.Contains(p, "kind: ConfigMap") {
+			continue
+		}
+		var resources []shared.KubernetesCRD
+		for _, doc := range strings.Split(p, "---\n") {
+			var r shared.KubernetesCRD
+			if err := yaml.Unmarshal([]byte(doc), &r); err != nil {
+				t.Fatalf("invalid manifest document: %v\n%s", err, doc)
+			}
+			resources = append(resources, r)
+		}
+		return resources
+	}
+	t.Fatalf("want manifest, got:\n%s", strings.Join(print.Prints, "\n"))
+	return nil
+}
+
+// checkManifest checks the kinds, names and labels of the manifest resources
+func checkManifest(t *testing.T, resources []shared.KubernetesCRD, wantKinds []string, wantNames []string) {
+	var kinds, names []string
+	for _, r := range resources {
+		kinds = append(kinds, r.Kind)
+		names = append(names, r.Metadata.Name)
+		if r.Metadata.Namespace != "apigee" {
+			t.Errorf("%s %s want namespace apigee, got: %s", r.Kind, r.Metadata.Name, r.Metadata.Namespace)
+		}
+		wantLabels := map[string]string{"app": adapterName, "org": "org", "env": "env"}
+		if !reflect.DeepEqual(wantLabels, r.Metadata.Labels) {
+			t.Errorf("%s %s want labels %v, got: %v", r.Kind, r.Metadata.Name, wantLabels, r.Metadata.Labels)
+		}
+	}
+	if !reflect.DeepEqual(wantKinds, kinds) {
+		t.Errorf("want kinds %v, got: %v", wantKinds, kinds)
+	}
+	if !reflect.DeepEqual(wantNames, names) {
+		t.Errorf("want names %v, got: %v", wantNames, names)
+	}
+}
+
+// secretKeyIDs returns the key IDs of the certificates of the policy Secret
+func secretKeyIDs(t *testing.T, secret shared.KubernetesCRD) []string {
+	data, err := base64.StdEncoding.DecodeString(secret.Data[jwksSecretKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwkSet, err := jwk.ParseBytes(data)
+	if err != nil {
+		t.Fatalf("invalid jwks: %v", err)
+	}
+	var kids []string
+	for _, key := range jwkSet.Keys {
+		kids = append(kids, key.KeyID())
+	}
+	return kids
+}
+
+func TestEmitKubernetesHybrid(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.New(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Set(jwk.KeyIDKey, "2000-01-01T00:00:00Z")
+	certs, err := json.Marshal(&jwk.Set{Keys: []jwk.Key{key}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	api := hybridProvisionServer(&calls, map[string]string{}, "")
+	defer api.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/remote-service/certs" {
+			w.Write(certs)
+			return
+		}
+		api.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	wantKinds := []string{"ConfigMap", "Secret", "ServiceAccount", "Deployment", "Service"}
+	name := "apigee-remote-service-envoy-org-env"
+	wantNames := []string{name, "org-env-policy-secret", name, name, name}
+
+	// the existing policy Secret is kept
+	print := testutil.Printer("TestEmitKubernetesHybrid")
+	err = executeProvision(print, "--emit", "kubernetes", "--management", ts.URL, "--runtime", ts.URL,
+		"-o", "org", "-e", "env", "-t", "/token/", "-d", "dev@example.com")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	checkManifest(t, manifestResources(t, print),
+		[]string{"ConfigMap", "ServiceAccount", "Deployment", "Service"}, []string{name, name, name, name})
+
+	// a Secret with a new key is emitted if there's none
+	certs = []byte(`{"keys": []}`)
+	print = testutil.Printer("TestEmitKubernetesHybrid")
+	err = executeProvision(print, "--emit", "kubernetes", "--management", ts.URL, "--runtime", ts.URL,
+		"-o", "org", "-e", "env", "-t", "/token/", "-d", "dev@example.com")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	resources := manifestResources(t, print)
+	checkManifest(t, resources, wantKinds, wantNames)
+	if kids := secretKeyIDs(t, resources[1]); len(kids) != 1 {
+		t.Errorf("want a new key, got: %v", kids)
+	}
+
+	// or if the existing certificates can't be retrieved
+	certs = []byte("unavailable")
+	print = testutil.Printer("TestEmitKubernetesHybrid")
+	err = executeProvision(print, "--emit", "kubernetes", "--management", ts.URL, "--runtime", ts.URL,
+		"-o", "org", "-e", "env", "-t", "/token/", "-d", "dev@example.com")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	resources = manifestResources(t, print)
+	checkManifest(t, resources, wantKinds, wantNames)
+	if kids := secretKeyIDs(t, resources[1]); len(kids) != 1 || kids[0] == "2000-01-01T00:00:00Z" {
+		t.Errorf("want only a new key, got: %v", kids)
+	}
+}
+
+func TestEmitKubernetesOPDK(t *testing.T) {
+	var calls []string
+	ts := opdkServer(&calls, "")
+	defer ts.Close()
+
+	print := testutil.Printer("TestEmitKubernetesOPDK")
+	err := executeProvision(print, "--emit", "kubernetes", "--opdk", "--management", ts.URL, "--runtime", ts.URL,
+		"-o", "org", "-e", "env", "-u", "/username/", "-p", "password")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	// no policy Secret
+	name := "apigee-remote-service-envoy-org-env"
+	checkManifest(t, manifestResources(t, print),
+		[]string{"ConfigMap", "ServiceAccount", "Deployment", "Service"}, []string{name, name, name, name})
+}
+
+func TestNewPolicySecret(t *testing.T) {
+	var existing []jwk.Key
+	for _, kid := range []string{"2000-01-01T00:00:00Z", "2001-01-01T00:00:00Z"} {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := jwk.New(&privateKey.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.Set(jwk.KeyIDKey, kid)
+		existing = append(existing, key)
+	}
+	certs, err := json.Marshal(&jwk.Set{Keys: existing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first attempt fails
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(certs)
+	}))
+	defer ts.Close()
+	client, err := apigee.NewEdgeClient(&apigee.EdgeClientOptions{
+		MgmtURL: ts.URL,
+		Org:     "org",
+		Env:     "env",
+		Auth:    &apigee.EdgeAuth{Username: "/username/", Password: "password"},
+		Retry:   apigee.RetryPolicy{MaxRetries: 1, MinBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// truncate 1 doesn't retrieve the existing certificates
+	secret, err := NewPolicySecret(context.Background(), client, "org", "env", "apigee", "/unused/",
+		1, shared.NoPrintf)
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	if secret.Metadata.Name != "org-env-policy-secret" || secret.Metadata.Namespace != "apigee" {
+		t.Errorf("want org-env-policy-secret in apigee, got: %v", secret.Metadata)
+	}
+	if kids := secretKeyIDs(t, secret); len(kids) != 1 {
+		t.Errorf("want a new key, got: %v", kids)
+	}
+	for _, k := range []string{keySecretKey, kidSecretKey} {
+		if secret.Data[k] == "" {
+			t.Errorf("want %s", k)
+		}
+	}
+
+	// the newest are kept, the failed retrieval is retried
+	secret, err = NewPolicySecret(context.Background(), client, "org", "env", "apigee", ts.URL,
+		2, shared.NoPrintf)
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("want 2 requests, got: %d", requests)
+	}
+	if kids := secretKeyIDs(t, secret); len(kids) != 2 || kids[1] != "2001-01-01T00:00:00Z" {
+		t.Errorf("want a new key and the newest existing key, got: %v", kids)
+	}
+
+	// the retrieval uses the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = NewPolicySecret(ctx, client, "org", "env", "apigee", ts.URL, 2, shared.NoPrintf); err == nil {
+		t.Errorf("want error for cancelled context")
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/pkg/errors"
+)
+
+// plan is called by `provision --dry-run`. It inspects the current state of
+// the org and envs and prints what provisioning would change, without making
+// any changes.
+func (p *provision) plan(printf shared.FormatFn) error {
+	envs, err := p.environments()
+	if err != nil {
+		return err
+	}
+	p.envs = envs
+	p.multiEnv = len(envs) > 1
+	p.imported = map[string]apigee.Revision{}
+
+	for i, env := range envs {
+		if p.multiEnv {
+			if err := p.useEnvironment(env); err != nil {
+				return errors.Wrapf(err, "environment %s", env)
+			}
+		}
+		if err := p.planEnvironment(i == 0, printf); err != nil {
+			return errors.Wrapf(err, "environment %s", env)
+		}
+	}
+
+	printf("dry run complete, no changes made")
+	return nil
+}
+
+// planEnvironment prints what provisioning would change in the current env.
+// Changes that aren't specific to an env are only printed if first.
+func (p *provision) planEnvironment(first bool, printf shared.FormatFn) error {
+	printf("plan for provisioning org %s env %s (dry run, no changes will be made):", p.Org, p.Env)
+
+	if p.IsOPDK {
+		if err := p.planProxy(internalProxyName, printf); err != nil {
+			return errors.Wrapf(err, "planning proxy %s", internalProxyName)
+		}
+	}
+	if err := p.planProxy(authProxyName, printf); err != nil {
+		return errors.Wrapf(err, "planning proxy %s", authProxyName)
+	}
+
+	if !p.IsGCPManaged {
+		exists, err := p.exists(func() error {
+			_, _, err := p.Client.CacheService.GetWithContext(p.Context(), cacheName)
+			return err
+		})
+		if err != nil {
+			return errors.Wrapf(err, "retrieving cache %s", cacheName)
+		}
+		printf("  cache %s: %s", cacheName, createOrReuse(exists))
+	}
+
+	if p.IsGCPManaged {
+		if first {
+			if err := p.planGCPCredential(printf); err != nil {
+				return errors.Wrap(err, "planning credential")
+			}
+		}
+	} else {
+		printf("  credential: would create a new key and secret")
+	}
+
+	if !p.IsGCPManaged {
+		exists, err := p.exists(func() error {
+			_, _, err := p.Client.KVMService.GetWithContext(p.Context(), kvmName)
+			return err
+		})
+		if err != nil {
+			return errors.Wrapf(err, "retrieving kvm %s", kvmName)
+		}
+		if exists {
+			printf("  kvm %s: exists, would keep its certificate", kvmName)
+		} else {
+			printf("  kvm %s: would create with a new key and certificate", kvmName)
+		}
+	}
+
+	return nil
+}
+
+// planProxy prints how checkAndDeployProxy would import and deploy a proxy
+func (p *provision) planProxy(name string, printf shared.FormatFn) error {
+	var oldRev *apigee.Revision
+	var err error
+	if p.IsGCPManaged {
+		oldRev, err = p.Client.Proxies.GetGCPDeployedRevisionWithContext(p.Context(), name)
+	} else {
+		oldRev, err = p.Client.Proxies.GetDeployedRevisionWithContext(p.Context(), name)
+	}
+	if err != nil {
+		return err
+	}
+	if oldRev != nil && !p.forceProxyInstall {
+		printf("  proxy %s: revision %s already deployed to %s, would leave as is", name, oldRev, p.Env)
+		return nil
+	}
+
+	// a revision planned for an earlier env would be imported only once
+	newRev, ok := p.imported[name]
+	if !ok {
+		proxy, _, err := p.Client.Proxies.GetWithContext(p.Context(), name)
+		if err != nil && !errors.Is(err, apigee.ErrNotFound) {
+			return err
+		}
+		newRev = 1
+		if proxy != nil && len(proxy.Revisions) > 0 {
+			sort.Sort(apigee.RevisionSlice(proxy.Revisions))
+			newRev = proxy.Revisions[len(proxy.Revisions)-1] + 1
+		}
+		p.imported[name] = newRev
+		printf("  proxy %s: would import revision %d", name, newRev)
+	}
+	if oldRev != nil {
+		if p.IsGCPManaged {
+			printf("  proxy %s: would replace revision %d in %s", name, *oldRev, p.Env)
+		} else {
+			printf("  proxy %s: would undeploy revision %d from %s", name, *oldRev, p.Env)
+		}
+	}
+	printf("  proxy %s: would deploy revision %d to %s", name, newRev, p.Env)
+	return nil
+}
+
+// planGCPCredential prints how createGCPCredential would create or reuse
+// the product, developer and app, and mint a credential
+func (p *provision) planGCPCredential(printf shared.FormatFn) error {
+	const removeServiceName = "remote-service"
+	devEmail := p.developerEmail
+
+	resources := []struct {
+		desc string
+		path string
+	}{
+		{fmt.Sprintf("product %s", removeServiceName), path.Join(apiProductsPath, removeServiceName)},
+		{fmt.Sprintf("developer %s", devEmail), path.Join(developersPath, devEmail)},
+		{fmt.Sprintf("app %s", removeServiceName), path.Join(fmt.Sprintf(applicationsPathFormat, devEmail), removeServiceName)},
+	}
+	productExists, appExists := false, false
+	for i, r := range resources {
+		exists, err := p.exists(func() error {
+			req, err := p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodGet, r.path, nil)
+			if err != nil {
+				return err
+			}
+			_, err = p.Client.Do(req, nil)
+			return err
+		})
+		if err != nil {
+			return errors.Wrapf(err, "retrieving %s", r.desc)
+		}
+		printf("  %s: %s", r.desc, createOrReuse(exists))
+		if i == 0 {
+			productExists = exists
+		}
+		appExists = exists
+	}
+
+	if productExists {
+		req, err := p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodGet, resources[0].path, nil)
+		if err != nil {
+			return err
+		}
+		var product map[string]interface{}
+		if _, err = p.Client.Do(req, &product); err != nil {
+			return errors.Wrapf(err, "retrieving %s", resources[0].desc)
+		}
+		if missing := p.missingEnvironments(product); len(missing) > 0 {
+			printf("  %s: would add environments %s", resources[0].desc, strings.Join(missing, ", "))
+		}
+	}
+
+	if appExists && p.reuseCredential {
+		printf("  credential: would reuse key %s of the config", p.ServerConfig.Tenant.Key)
+	} else if appExists {
+		printf("  credential: would add a new key and secret to app %s", removeServiceName)
+	} else {
+		printf("  credential: would use the key and secret of the new app %s", removeServiceName)
+	}
+	return nil
+}
+
+// exists calls get and returns false if it fails with not found
+func (p *provision) exists(get func() error) (bool, error) {
+	err := get()
+	if errors.Is(err, apigee.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func createOrReuse(exists bool) string {
+	if exists {
+		return "exists, would reuse"
+	}
+	return "would create"
+}
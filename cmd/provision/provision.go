@@ -34,8 +34,10 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -76,6 +78,7 @@ const ( // modern
 	applicationsPathFormat = "developers/%s/apps"                // developer email
 	keyCreatePathFormat    = "developers/%s/apps/%s/keys/create" // developer email, app ID
 	keyPathFormat          = "developers/%s/apps/%s/keys/%s"     // developer email, app ID, key ID
+	environmentsPath       = "environments"
 
 	certsURLFormat        = "%s/certs"        // RemoteServiceProxyURL
 	productsURLFormat     = "%s/products"     // RemoteServiceProxyURL
@@ -83,6 +86,15 @@ const ( // modern
 	quotasURLFormat       = "%s/quotas"       // RemoteServiceProxyURL
 	rotateURLFormat       = "%s/rotate"       // RemoteServiceProxyURL
 
+	defaultConfigMapName = "apigee-remote-service-envoy"
+
+	// files written to --output-dir
+	configFileName       = "config.yaml"
+	manifestFileName     = "manifest.yaml"
+	helmValuesFileName   = "values.yaml"
+	certFileFormat       = "%s-%s-jwt-certificate.pem" // org, env
+	privateKeyFileFormat = "%s-%s-jwt-private-key.pem" // org, env
+
 	remoteServiceAPIURLFormat = "https://apigee-runtime-%s-%s.%s:8443/remote-service" // org, env, namespace
 
 	fluentdInternalFormat = "apigee-udca-%s-%s.%s:20001" // org, env, namespace
@@ -102,6 +114,22 @@ type provision struct {
 	provisionSecret       string
 	developerEmail        string
 	namespace             string
+	noRollback            bool
+	dryRun                bool
+	allEnvironments       bool
+	reuseCredential       bool
+	emit                  string
+	image                 string
+	outputDir             string
+	outputFile            string
+
+	changes  changes                    // made by this provision, undone on failure
+	envs     []string                   // the environments to provision
+	multiEnv bool                       // provisioning more than one environment
+	imported map[string]apigee.Revision // proxy revisions imported (or planned, for --dry-run)
+
+	resources []shared.KubernetesCRD // collected for --emit helm or kustomize
+	workloads []namedDoc             // collected for --emit kustomize
 }
 
 // Cmd returns base command
@@ -113,21 +141,41 @@ func Cmd(rootArgs *shared.RootArgs, printf shared.FormatFn) *cobra.Command {
 		Short: "Provision your Apigee environment for remote services",
 		Long: `The provision command will set up your Apigee environment for remote services. This includes creating
 and installing a remote-service kvm with certificates, creating credentials, and deploying a remote-service proxy
-to your organization and environment.`,
+to your organization and environment.
+
+Multiple environments may be provisioned at once by passing a comma-separated list to --environment,
+or by using --all-environments. The proxies are imported once and deployed to each environment, and
+a configuration is emitted for each (as a multi-document YAML).
+
+Use --emit kubernetes to emit a manifest that deploys apigee-remote-service-envoy: the config ConfigMap,
+the JWT policy Secret (hybrid only), and a ServiceAccount, Deployment and Service. The Secret is only
+emitted if the remote-service proxy has no key yet, use "token create-secret" to rotate it. Use --emit
+helm to emit the ConfigMap and Secret as a Helm values.yaml fragment, or --emit kustomize to write the
+manifest as a Kustomize base to --output-dir.
+
+Use --output-file to write the configuration (or --emit output) to a file rather than stdout, or
+--output-dir to write it along with the generated JWT certificate and private key to a directory.
+Files written are readable only by the user. Verbose output is printed to stderr.`,
 		Args: cobra.NoArgs,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			err := rootArgs.Resolve(false, true)
-			if err == nil {
-				if p.IsGCPManaged && !p.verifyOnly {
-					missingFlagNames := []string{}
-					if p.Token == "" {
-						missingFlagNames = append(missingFlagNames, "token")
-					}
-					if p.developerEmail == "" {
-						missingFlagNames = append(missingFlagNames, "developer-email")
-					}
-					err = p.PrintMissingFlags(missingFlagNames)
-				}
+			multiEnv := p.allEnvironments || strings.Contains(p.Env, ",")
+			if multiEnv && p.ConfigPath != "" {
+				return fmt.Errorf("--config can't be used with multiple environments")
+			}
+			if p.allEnvironments && p.Env != "" {
+				return fmt.Errorf("--environment and --all-environments are mutually exclusive")
+			}
+			if p.reuseCredential && p.ConfigPath == "" {
+				return fmt.Errorf("--reuse-credential requires --config")
+			}
+			// the runtime is resolved for each environment
+			err := rootArgs.Resolve(false, !multiEnv)
+			if err == nil && p.reuseCredential && !p.IsGCPManaged {
+				return fmt.Errorf("--reuse-credential is only supported for hybrid")
+			}
+			// Resolve has checked for hybrid auth
+			if err == nil && p.IsGCPManaged && !p.verifyOnly && p.developerEmail == "" {
+				err = p.PrintMissingFlags([]string{"developer-email"})
 			}
 			return err
 		},
@@ -136,7 +184,29 @@ to your organization and environment.`,
 			if p.verifyOnly && (p.provisionKey == "" || p.provisionSecret == "") {
 				return fmt.Errorf("--verify-only requires values for --key and --secret")
 			}
-			return p.run(printf)
+			switch p.emit {
+			case "", emitKubernetes, shared.EmitHelm, shared.EmitKustomize:
+			default:
+				return fmt.Errorf("unknown --emit format %q, must be one of: %s, %s, %s",
+					p.emit, emitKubernetes, shared.EmitHelm, shared.EmitKustomize)
+			}
+			if p.emit == shared.EmitKustomize && p.outputDir == "" {
+				return fmt.Errorf("--emit kustomize requires --output-dir")
+			}
+			if p.outputFile != "" && p.outputDir != "" {
+				return fmt.Errorf("--output-file and --output-dir are mutually exclusive")
+			}
+			if p.dryRun {
+				if p.verifyOnly {
+					return fmt.Errorf("--dry-run and --verify-only are mutually exclusive")
+				}
+				return p.plan(printf)
+			}
+			err := p.run(printf)
+			if err == errVerificationFailed {
+				cmd.SilenceUsage = true
+			}
+			return err
 		},
 	}
 
@@ -149,6 +219,10 @@ to your organization and environment.`,
 
 	c.Flags().StringVarP(&rootArgs.Token, "token", "t", "",
 		"Apigee OAuth or SAML token (hybrid only)")
+	c.Flags().StringVarP(&rootArgs.ServiceAccount, "service-account", "", "",
+		"Google service account key file for OAuth tokens (hybrid only)")
+	c.Flags().BoolVarP(&rootArgs.UseADC, "adc", "", false,
+		"use Google Application Default Credentials for OAuth tokens (hybrid only)")
 	c.Flags().StringVarP(&rootArgs.Username, "username", "u", "",
 		"Apigee username (legacy or OPDK only)")
 	c.Flags().StringVarP(&rootArgs.Password, "password", "p", "",
@@ -166,8 +240,24 @@ to your organization and environment.`,
 		"override proxy virtualHosts")
 	c.Flags().BoolVarP(&p.verifyOnly, "verify-only", "", false,
 		"verify only, don’t provision anything")
+	c.Flags().BoolVarP(&p.noRollback, "no-rollback", "", false,
+		"don't undo the changes made by a failed provision")
+	c.Flags().BoolVarP(&p.dryRun, "dry-run", "", false,
+		"print what would be provisioned without making changes")
+	c.Flags().BoolVarP(&p.allEnvironments, "all-environments", "", false,
+		"provision all environments of the organization")
+	c.Flags().BoolVarP(&p.reuseCredential, "reuse-credential", "", false,
+		"reuse the key and secret of --config rather than creating a new credential (hybrid only)")
 	c.Flags().StringVarP(&p.namespace, "namespace", "n", "",
 		"emit configuration as an Envoy ConfigMap in the specified namespace")
+	c.Flags().StringVarP(&p.emit, "emit", "", "",
+		"emit a deployment rather than only the configuration: kubernetes, helm (values) or kustomize (base)")
+	c.Flags().StringVarP(&p.outputFile, "output-file", "", "",
+		"write the configuration (or --emit output) to a file rather than stdout")
+	c.Flags().StringVarP(&p.outputDir, "output-dir", "", "",
+		"write the configuration, JWT certificate and key (and --emit output) to files in a directory")
+	c.Flags().StringVarP(&p.image, "image", "", defaultAdapterImage,
+		"apigee-remote-service-envoy image (for --emit)")
 
 	c.Flags().StringVarP(&p.provisionKey, "key", "k", "", "gateway key (for --verify-only)")
 	c.Flags().StringVarP(&p.provisionSecret, "secret", "s", "", "gateway secret (for --verify-only)")
@@ -175,123 +265,271 @@ to your organization and environment.`,
 	return c
 }
 
-func (p *provision) run(printf shared.FormatFn) error {
+// errVerificationFailed is returned by run when provisioning succeeded but
+// its verification did not. The config has been output, so nothing is rolled
+// back.
+var errVerificationFailed = &shared.ExitError{Code: 1, Err: errors.New("provisioning verification failed")}
+
+func (p *provision) run(printf shared.FormatFn) (err error) {
 
 	var cred *credential
 
+	defer func() {
+		if err != nil && err != errVerificationFailed {
+			p.handleFailure(failuref)
+		}
+	}()
+
 	var verbosef = shared.NoPrintf
-	if p.Verbose || p.verifyOnly {
+	if p.verifyOnly {
 		verbosef = printf
 	}
+	if p.Verbose {
+		verbosef = shared.Errorf // keep diagnostics out of the generated config
+	}
 
-	if !p.verifyOnly {
+	if p.outputDir != "" {
+		if err := os.MkdirAll(p.outputDir, 0700); err != nil {
+			return errors.Wrapf(err, "creating output dir %s", p.outputDir)
+		}
+	}
 
-		tempDir, err := ioutil.TempDir("", "apigee")
-		if err != nil {
-			return errors.Wrap(err, "creating temp dir")
+	envs, err := p.environments()
+	if err != nil {
+		return err
+	}
+	p.envs = envs
+	p.multiEnv = len(envs) > 1
+	p.imported = map[string]apigee.Revision{}
+
+	if p.verifyOnly {
+		cred = &credential{
+			Key:    p.provisionKey,
+			Secret: p.provisionSecret,
+		}
+	}
+
+	// configs are printed once all environments are provisioned
+	var configs []string
+	bufferf := func(format string, args ...interface{}) {
+		configs = append(configs, fmt.Sprintf(format, args...))
+	}
+
+	status := map[string]string{}
+	failed := func(env string, err error) error {
+		if !p.multiEnv {
+			return err
 		}
-		defer os.RemoveAll(tempDir)
+		status[env] = fmt.Sprintf("failed: %v", err)
+		printStatus(envs, status)
+		return errors.Wrapf(err, "environment %s", env)
+	}
 
-		replaceVH := func(proxyDir string) error {
-			proxiesFile := filepath.Join(proxyDir, "proxies", "default.xml")
-			bytes, err := ioutil.ReadFile(proxiesFile)
-			if err != nil {
-				return errors.Wrapf(err, "reading file %s", proxiesFile)
-			}
-			newVH := ""
-			for _, vh := range strings.Split(p.virtualHosts, ",") {
-				if strings.TrimSpace(vh) != "" {
-					newVH = newVH + fmt.Sprintf(virtualHostReplacementFmt, vh)
-				}
+	var verifyFailed bool
+	for _, env := range envs {
+		if p.multiEnv {
+			verbosef("provisioning environment %s...", env)
+			if err := p.useEnvironment(env); err != nil {
+				return failed(env, err)
 			}
-			bytes = []byte(strings.Replace(string(bytes), virtualHostReplaceText, newVH, 1))
-			if err := ioutil.WriteFile(proxiesFile, bytes, 0); err != nil {
-				return errors.Wrapf(err, "writing file %s", proxiesFile)
-			}
-			return nil
 		}
 
-		replaceInFile := func(file, old, new string) error {
-			bytes, err := ioutil.ReadFile(file)
-			if err != nil {
-				return errors.Wrapf(err, "reading file %s", file)
+		envCred := cred
+		if !p.verifyOnly {
+			if envCred, err = p.provisionEnvironment(cred, verbosef); err != nil {
+				return failed(env, err)
 			}
-			bytes = []byte(strings.Replace(string(bytes), old, new, 1))
-			if err := ioutil.WriteFile(file, bytes, 0); err != nil {
-				return errors.Wrapf(err, "writing file %s", file)
+			if p.IsGCPManaged {
+				cred = envCred
 			}
-			return nil
 		}
 
-		replaceVHAndAuthTarget := func(proxyDir string) error {
-			if err := replaceVH(proxyDir); err != nil {
-				return err
+		verifyErrors, err := p.verify(envCred, verbosef)
+		if err != nil {
+			return failed(env, err)
+		}
+
+		if !p.verifyOnly {
+			if len(configs) > 0 {
+				bufferf("---")
 			}
+			print := p.printConfig
+			switch p.emit {
+			case emitKubernetes:
+				print = p.printKubernetes
+			case shared.EmitHelm, shared.EmitKustomize:
+				print = p.collectResources
+			}
+			if err := print(envCred, bufferf, verifyErrors); err != nil {
+				return failed(env, errors.Wrapf(err, "generating config"))
+			}
+		}
 
-			if p.IsOPDK {
-				// OPDK must target local internal proxy
-				authFile := filepath.Join(proxyDir, "policies", "Authenticate-Call.xml")
-				oldTarget := "https://edgemicroservices.apigee.net"
-				newTarget := p.RuntimeBase
-				if err := replaceInFile(authFile, oldTarget, newTarget); err != nil {
-					return err
-				}
+		status[env] = "provisioned"
+		if verifyErrors != nil {
+			status[env] = "provisioned, verification failed"
+			verifyFailed = true
+		}
+	}
 
-				// OPDK must have org.noncps = true for products callout
-				calloutFile := filepath.Join(proxyDir, "policies", "JavaCallout.xml")
-				oldValue := "</Properties>"
-				newValue := `<Property name="org.noncps">true</Property>
-				</Properties>`
-				if err := replaceInFile(calloutFile, oldValue, newValue); err != nil {
-					return err
-				}
-			}
-			return nil
+	out := printf
+	var output bytes.Buffer
+	outputFile := p.outputPath()
+	if outputFile != "" {
+		out = shared.WriterFormatFn(&output)
+	}
+	for _, config := range configs {
+		out("%s", config)
+	}
+	if len(p.resources) > 0 {
+		if err := p.emitResources(out); err != nil {
+			return errors.Wrap(err, "generating config")
 		}
+	}
+	if output.Len() > 0 {
+		if err := shared.WriteFile(outputFile, output.String()); err != nil {
+			return errors.Wrapf(err, "writing config to %s", outputFile)
+		}
+		printf("config written to %s", outputFile)
+	}
+	if p.multiEnv {
+		printStatus(envs, status)
+	}
 
-		if p.IsOPDK {
-			if err := p.deployInternalProxy(replaceVH, tempDir, verbosef); err != nil {
-				return errors.Wrap(err, "deploying internal proxy")
+	if verifyFailed {
+		return errVerificationFailed
+	}
+
+	verbosef("provisioning verified OK")
+	return nil
+}
+
+// outputPath returns the file to write the generated config to, or "" for stdout
+func (p *provision) outputPath() string {
+	if p.outputDir == "" {
+		return p.outputFile
+	}
+	switch p.emit {
+	case emitKubernetes:
+		return filepath.Join(p.outputDir, manifestFileName)
+	case shared.EmitHelm:
+		return filepath.Join(p.outputDir, helmValuesFileName)
+	case shared.EmitKustomize:
+		return "" // the base is written by emitResources
+	}
+	return filepath.Join(p.outputDir, configFileName)
+}
+
+// provisionEnvironment deploys the proxies, credential and kvm to the
+// current environment. On hybrid, cred is reused if not nil.
+func (p *provision) provisionEnvironment(cred *credential, verbosef shared.FormatFn) (*credential, error) {
+	tempDir, err := ioutil.TempDir("", "apigee")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temp dir")
+	}
+	defer os.RemoveAll(tempDir)
+
+	replaceVH := func(proxyDir string) error {
+		proxiesFile := filepath.Join(proxyDir, "proxies", "default.xml")
+		bytes, err := ioutil.ReadFile(proxiesFile)
+		if err != nil {
+			return errors.Wrapf(err, "reading file %s", proxiesFile)
+		}
+		newVH := ""
+		for _, vh := range strings.Split(p.virtualHosts, ",") {
+			if strings.TrimSpace(vh) != "" {
+				newVH = newVH + fmt.Sprintf(virtualHostReplacementFmt, vh)
 			}
 		}
-
-		// input remote-service proxy
-		var customizedProxy string
-		if p.IsGCPManaged {
-			customizedProxy, err = getCustomizedProxy(tempDir, remoteServiceProxyZip, nil)
-		} else {
-			customizedProxy, err = getCustomizedProxy(tempDir, legacyAuthProxyZip, replaceVHAndAuthTarget)
+		bytes = []byte(strings.Replace(string(bytes), virtualHostReplaceText, newVH, 1))
+		if err := ioutil.WriteFile(proxiesFile, bytes, 0); err != nil {
+			return errors.Wrapf(err, "writing file %s", proxiesFile)
 		}
+		return nil
+	}
+
+	replaceInFile := func(file, old, new string) error {
+		bytes, err := ioutil.ReadFile(file)
 		if err != nil {
-			return err
+			return errors.Wrapf(err, "reading file %s", file)
+		}
+		bytes = []byte(strings.Replace(string(bytes), old, new, 1))
+		if err := ioutil.WriteFile(file, bytes, 0); err != nil {
+			return errors.Wrapf(err, "writing file %s", file)
 		}
+		return nil
+	}
 
-		if err := p.checkAndDeployProxy(authProxyName, customizedProxy, verbosef); err != nil {
-			return errors.Wrapf(err, "deploying proxy %s", authProxyName)
+	replaceVHAndAuthTarget := func(proxyDir string) error {
+		if err := replaceVH(proxyDir); err != nil {
+			return err
 		}
 
-		if p.IsGCPManaged {
-			cred, err = p.createGCPCredential(verbosef)
-		} else {
-			cred, err = p.createLegacyCredential(verbosef)
+		if p.IsOPDK {
+			// OPDK must target local internal proxy
+			authFile := filepath.Join(proxyDir, "policies", "Authenticate-Call.xml")
+			oldTarget := "https://edgemicroservices.apigee.net"
+			newTarget := p.RuntimeBase
+			if err := replaceInFile(authFile, oldTarget, newTarget); err != nil {
+				return err
+			}
+
+			// OPDK must have org.noncps = true for products callout
+			calloutFile := filepath.Join(proxyDir, "policies", "JavaCallout.xml")
+			oldValue := "</Properties>"
+			newValue := `<Property name="org.noncps">true</Property>
+			</Properties>`
+			if err := replaceInFile(calloutFile, oldValue, newValue); err != nil {
+				return err
+			}
 		}
-		if err != nil {
-			return errors.Wrapf(err, "generating credential")
+		return nil
+	}
+
+	if p.IsOPDK {
+		if err := p.deployInternalProxy(replaceVH, tempDir, verbosef); err != nil {
+			return nil, errors.Wrap(err, "deploying internal proxy")
 		}
+	}
 
-		if !p.IsGCPManaged {
-			if err := p.getOrCreateKVM(cred, verbosef); err != nil {
-				return errors.Wrapf(err, "retrieving or creating kvm")
-			}
+	// input remote-service proxy
+	var customizedProxy string
+	if p.IsGCPManaged {
+		customizedProxy, err = getCustomizedProxy(tempDir, remoteServiceProxyZip, nil)
+	} else {
+		customizedProxy, err = getCustomizedProxy(tempDir, legacyAuthProxyZip, replaceVHAndAuthTarget)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.checkAndDeployProxy(authProxyName, customizedProxy, verbosef); err != nil {
+		return nil, errors.Wrapf(err, "deploying proxy %s", authProxyName)
+	}
+
+	if p.IsGCPManaged {
+		if cred == nil { // one credential for all environments
+			cred, err = p.createGCPCredential(verbosef)
 		}
+	} else {
+		cred, err = p.createLegacyCredential(verbosef)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "generating credential")
+	}
 
-	} else { // verifyOnly == true
-		cred = &credential{
-			Key:    p.provisionKey,
-			Secret: p.provisionSecret,
+	if !p.IsGCPManaged {
+		if err := p.getOrCreateKVM(cred, verbosef); err != nil {
+			return nil, errors.Wrapf(err, "retrieving or creating kvm")
 		}
 	}
 
+	return cred, nil
+}
+
+// verify verifies the proxies of the current environment using cred. Failed
+// verifications are returned as verifyErrors.
+func (p *provision) verify(cred *credential, verbosef shared.FormatFn) (verifyErrors, err error) {
 	// use generated credentials
 	opts := *p.ClientOpts
 	if cred != nil {
@@ -299,13 +537,11 @@ func (p *provision) run(printf shared.FormatFn) error {
 			Username: cred.Key,
 			Password: cred.Secret,
 		}
-		var err error
 		if p.Client, err = apigee.NewEdgeClient(&opts); err != nil {
-			return errors.Wrapf(err, "creating new client")
+			return nil, errors.Wrapf(err, "creating new client")
 		}
 	}
 
-	var verifyErrors error
 	if p.IsLegacySaaS || p.IsOPDK {
 		verbosef("verifying internal proxy...")
 		verifyErrors = p.verifyInternalProxy(opts.Auth, verbosef)
@@ -316,25 +552,70 @@ func (p *provision) run(printf shared.FormatFn) error {
 
 	if verifyErrors != nil {
 		shared.Errorf("\nWARNING: Apigee may not be provisioned properly.")
-		shared.Errorf("Unable to verify proxy endpoint(s). Errors:\n")
+		if p.multiEnv {
+			shared.Errorf("Unable to verify proxy endpoint(s) in environment %s. Errors:\n", p.Env)
+		} else {
+			shared.Errorf("Unable to verify proxy endpoint(s). Errors:\n")
+		}
 		for _, err := range multierr.Errors(verifyErrors) {
 			shared.Errorf("  %s", err)
 		}
 		shared.Errorf("\n")
 	}
 
-	if !p.verifyOnly {
-		if err := p.printConfig(cred, printf, verifyErrors); err != nil {
-			return errors.Wrapf(err, "generating config")
+	return verifyErrors, nil
+}
+
+// environments returns the environments to provision: all of the org's for
+// --all-environments, or the comma-separated list of --environment
+func (p *provision) environments() ([]string, error) {
+	if !p.allEnvironments {
+		var envs []string
+		seen := map[string]bool{}
+		for _, env := range strings.Split(p.Env, ",") {
+			env = strings.TrimSpace(env)
+			if env != "" && !seen[env] {
+				seen[env] = true
+				envs = append(envs, env)
+			}
 		}
+		if len(envs) == 0 {
+			return []string{p.Env}, nil
+		}
+		return envs, nil
 	}
 
-	if verifyErrors != nil {
-		os.Exit(1)
+	req, err := p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodGet, environmentsPath, nil)
+	if err != nil {
+		return nil, err
 	}
+	var envs []string
+	if _, err = p.Client.Do(req, &envs); err != nil {
+		return nil, errors.Wrap(err, "retrieving environments")
+	}
+	if len(envs) == 0 {
+		return nil, fmt.Errorf("no environments in org %s", p.Org)
+	}
+	sort.Strings(envs)
+	return envs, nil
+}
 
-	verbosef("provisioning verified OK")
-	return nil
+// useEnvironment points the client and the runtime URLs at env
+func (p *provision) useEnvironment(env string) error {
+	p.Env = env
+	return p.Resolve(false, true)
+}
+
+// printStatus prints the provisioning status of each environment to stderr
+func printStatus(envs []string, status map[string]string) {
+	shared.Errorf("provisioning status:")
+	for _, env := range envs {
+		s, ok := status[env]
+		if !ok {
+			s = "not provisioned"
+		}
+		shared.Errorf("  environment %s: %s", env, s)
+	}
 }
 
 // ensures that there's a product, developer, and app
@@ -351,19 +632,25 @@ func (p *provision) createGCPCredential(verbosef shared.FormatFn) (*credential,
 		},
 		Description:  removeServiceName + " access",
 		APIResources: []string{"/**"},
-		Environments: []string{p.Env},
+		Environments: p.envs, // the credential is used for all
 		Proxies:      []string{removeServiceName},
 	}
-	req, err := p.Client.NewRequestNoEnv(http.MethodPost, apiProductsPath, product)
+	req, err := p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodPost, apiProductsPath, product)
 	if err != nil {
 		return nil, err
 	}
-	res, err := p.Client.Do(req, nil)
+	_, err = p.Client.Do(req, nil) // conflict is ok
 	if err != nil {
-		if res.StatusCode != http.StatusConflict { // exists
+		if !errors.Is(err, apigee.ErrConflict) {
 			return nil, err
 		}
 		verbosef("product %s already exists", removeServiceName)
+		if err := p.addProductEnvironments(removeServiceName, verbosef); err != nil {
+			return nil, errors.Wrapf(err, "updating product %s", removeServiceName)
+		}
+	} else {
+		p.changes.add(fmt.Sprintf("product %s", removeServiceName),
+			p.deleteResource(path.Join(apiProductsPath, removeServiceName)))
 	}
 
 	// create developer
@@ -374,66 +661,148 @@ func (p *provision) createGCPCredential(verbosef shared.FormatFn) (*credential,
 		LastName:  removeServiceName,
 		UserName:  removeServiceName,
 	}
-	req, err = p.Client.NewRequestNoEnv(http.MethodPost, developersPath, dev)
+	req, err = p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodPost, developersPath, dev)
 	if err != nil {
 		return nil, err
 	}
-	res, err = p.Client.Do(req, nil)
+	_, err = p.Client.Do(req, nil) // conflict is ok
 	if err != nil {
-		if res.StatusCode != http.StatusConflict { // exists
+		if !errors.Is(err, apigee.ErrConflict) {
 			return nil, err
 		}
 		verbosef("developer %s already exists", devEmail)
+	} else {
+		p.changes.add(fmt.Sprintf("developer %s", devEmail),
+			p.deleteResource(path.Join(developersPath, devEmail)))
 	}
 
 	// create application
-	app := application{
+	app := shared.App{
 		Name:        removeServiceName,
 		APIProducts: []string{removeServiceName},
 	}
 	applicationsPath := fmt.Sprintf(applicationsPathFormat, devEmail)
-	req, err = p.Client.NewRequestNoEnv(http.MethodPost, applicationsPath, &app)
+	req, err = p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodPost, applicationsPath, &app)
 	if err != nil {
 		return nil, err
 	}
-	res, err = p.Client.Do(req, &app)
+	_, err = p.Client.Do(req, &app)
 	if err == nil {
+		p.changes.add(fmt.Sprintf("app %s", removeServiceName),
+			p.deleteResource(path.Join(applicationsPath, removeServiceName)))
 		appCred := app.Credentials[0]
 		cred := &credential{
 			Key:    appCred.Key,
 			Secret: appCred.Secret,
 		}
+		if p.reuseCredential {
+			shared.Errorf("WARNING: app %s was created, the credential of the config can't be reused", removeServiceName)
+		}
 		verbosef("credentials created: %v", cred)
 		return cred, nil
 	}
 
-	if res == nil || res.StatusCode != http.StatusConflict {
+	if !errors.Is(err, apigee.ErrConflict) {
 		return nil, err
 	}
 
-	// http.StatusConflict == app exists, create a new credential
 	verbosef("app %s already exists", removeServiceName)
-	appCred := appCredential{
+	if p.reuseCredential {
+		return p.reuseConfigCredential(verbosef)
+	}
+
+	// app exists, create a new credential
+	return p.createAppKey(verbosef)
+}
+
+// addProductEnvironments adds the environments being provisioned to an
+// existing product. The product is updated as retrieved, so fields that
+// aren't known here are kept.
+func (p *provision) addProductEnvironments(name string, verbosef shared.FormatFn) error {
+	productPath := path.Join(apiProductsPath, name)
+	req, err := p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodGet, productPath, nil)
+	if err != nil {
+		return err
+	}
+	var product map[string]interface{}
+	if _, err = p.Client.Do(req, &product); err != nil {
+		return err
+	}
+
+	missing := p.missingEnvironments(product)
+	if len(missing) == 0 {
+		return nil
+	}
+	updated := map[string]interface{}{}
+	for k, v := range product {
+		updated[k] = v
+	}
+	envs, _ := product["environments"].([]interface{})
+	for _, env := range missing {
+		envs = append(envs, env)
+	}
+	updated["environments"] = envs
+
+	if req, err = p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodPut, productPath, updated); err != nil {
+		return err
+	}
+	if _, err = p.Client.Do(req, nil); err != nil {
+		return err
+	}
+	p.changes.add(fmt.Sprintf("environments %s of product %s", strings.Join(missing, ", "), name),
+		p.updateResource(productPath, product))
+	verbosef("environments %s added to product %s", strings.Join(missing, ", "), name)
+	return nil
+}
+
+// missingEnvironments returns the environments being provisioned that the
+// product, as retrieved, doesn't include
+func (p *provision) missingEnvironments(product map[string]interface{}) []string {
+	has := map[string]bool{}
+	envs, _ := product["environments"].([]interface{})
+	for _, env := range envs {
+		if name, ok := env.(string); ok {
+			has[name] = true
+		}
+	}
+	var missing []string
+	for _, env := range p.envs {
+		if !has[env] {
+			missing = append(missing, env)
+		}
+	}
+	return missing
+}
+
+// createAppKey creates a new key of the existing remote-service app
+func (p *provision) createAppKey(verbosef shared.FormatFn) (*credential, error) {
+	const removeServiceName = "remote-service"
+	devEmail := p.developerEmail
+
+	appCred := shared.AppCredential{
 		Key:    newHash(),
 		Secret: newHash(),
 	}
 	createKeyPath := fmt.Sprintf(keyCreatePathFormat, devEmail, removeServiceName)
-	if req, err = p.Client.NewRequestNoEnv(http.MethodPost, createKeyPath, &appCred); err != nil {
+	req, err := p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodPost, createKeyPath, &appCred)
+	if err != nil {
 		return nil, err
 	}
-	if res, err = p.Client.Do(req, &appCred); err != nil {
+	if _, err = p.Client.Do(req, &appCred); err != nil {
 		return nil, err
 	}
+	keyPath := fmt.Sprintf(keyPathFormat, devEmail, removeServiceName, appCred.Key)
+	p.changes.add(fmt.Sprintf("app %s key %s", removeServiceName, appCred.Key),
+		p.deleteResource(keyPath))
 
 	// adding product to the credential requires a separate call
 	appCredDetails := appCredentialDetails{
 		APIProducts: []string{removeServiceName},
 	}
-	keyPath := fmt.Sprintf(keyPathFormat, devEmail, removeServiceName, appCred.Key)
-	if req, err = p.Client.NewRequestNoEnv(http.MethodPost, keyPath, &appCredDetails); err != nil {
+	if req, err = p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodPost, keyPath, &appCredDetails); err != nil {
 		return nil, err
 	}
-	if res, err = p.Client.Do(req, &appCred); err != nil {
+	if _, err = p.Client.Do(apigee.MarkRetryable(req), &appCred); err != nil {
 		return nil, err
 	}
 
@@ -446,6 +815,66 @@ func (p *provision) createGCPCredential(verbosef shared.FormatFn) (*credential,
 	return cred, nil
 }
 
+// CreateCredential creates a new credential for apigee-remote-service-envoy:
+// a new key of the remote-service app of developerEmail for hybrid, or a new
+// internal credential for legacy SaaS or OPDK
+func CreateCredential(rootArgs *shared.RootArgs, developerEmail string, printf shared.FormatFn) (key, secret string, err error) {
+	p := &provision{RootArgs: rootArgs, developerEmail: developerEmail}
+	var cred *credential
+	if p.IsGCPManaged {
+		cred, err = p.createAppKey(printf)
+	} else {
+		cred, err = p.createLegacyCredential(printf)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return cred.Key, cred.Secret, nil
+}
+
+// reuseConfigCredential validates that the key of the config is an approved
+// credential of the remote-service app for the remote-service product
+func (p *provision) reuseConfigCredential(verbosef shared.FormatFn) (*credential, error) {
+	const removeServiceName = "remote-service"
+	tenant := p.ServerConfig.Tenant
+
+	keyPath := fmt.Sprintf(keyPathFormat, p.developerEmail, removeServiceName, tenant.Key)
+	req, err := p.Client.NewRequestNoEnvWithContext(p.Context(), http.MethodGet, keyPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var appCred shared.AppCredential
+	if _, err = p.Client.Do(req, &appCred); err != nil {
+		if errors.Is(err, apigee.ErrNotFound) {
+			return nil, fmt.Errorf("key %s of the config is not a credential of app %s", tenant.Key, removeServiceName)
+		}
+		return nil, err
+	}
+
+	if appCred.Secret != tenant.Secret {
+		return nil, fmt.Errorf("secret of the config doesn't match key %s", tenant.Key)
+	}
+	if appCred.Status != "" && appCred.Status != "approved" {
+		return nil, fmt.Errorf("key %s of the config is %s", tenant.Key, appCred.Status)
+	}
+	approved := false
+	for _, prod := range appCred.APIProducts {
+		if prod.Name == removeServiceName && (prod.Status == "" || prod.Status == "approved") {
+			approved = true
+		}
+	}
+	if !approved {
+		return nil, fmt.Errorf("key %s of the config is not approved for product %s", tenant.Key, removeServiceName)
+	}
+
+	cred := &credential{
+		Key:    appCred.Key,
+		Secret: appCred.Secret,
+	}
+	verbosef("reusing credential %s of the config", cred.Key)
+	return cred, nil
+}
+
 func (p *provision) deployInternalProxy(replaceVirtualHosts func(proxyDir string) error, tempDir string, verbosef shared.FormatFn) error {
 
 	customizedZip, err := getCustomizedProxy(tempDir, internalProxyZip, func(proxyDir string) error {
@@ -545,7 +974,7 @@ func newHash() string {
 
 	t := time.Now()
 	h := sha256.New()
-	h.Write([]byte(t.String() + string(rnd.Int())))
+	h.Write([]byte(t.String() + strconv.Itoa(rnd.Int())))
 	str := hex.EncodeToString(h.Sum(nil))
 	return str
 }
@@ -594,6 +1023,16 @@ func GenKeyCert(keyStrength, certExpirationInYears int) (string, string, error)
 //check if the KVM exists, if it doesn't, create a new one and sets certs for JWT
 func (p *provision) getOrCreateKVM(cred *credential, printf shared.FormatFn) error {
 
+	// an existing KVM keeps its key, so only generate one to create it
+	_, _, err := p.Client.KVMService.GetWithContext(p.Context(), kvmName)
+	if err == nil {
+		printf("kvm %s already exists", kvmName)
+		return nil
+	}
+	if !errors.Is(err, apigee.ErrNotFound) {
+		return errors.Wrapf(err, "retrieving kvm %s", kvmName)
+	}
+
 	cert, privateKey, err := GenKeyCert(p.certKeyStrength, p.certExpirationInYears)
 	if err != nil {
 		return err
@@ -621,11 +1060,11 @@ func (p *provision) getOrCreateKVM(cred *credential, printf shared.FormatFn) err
 		}
 	}
 
-	resp, err := p.Client.KVMService.Create(kvm)
-	if err != nil && (resp == nil || resp.StatusCode != http.StatusConflict) { // http.StatusConflict == already exists
+	resp, err := p.Client.KVMService.CreateWithContext(p.Context(), kvm)
+	if err != nil && !errors.Is(err, apigee.ErrConflict) {
 		return err
 	}
-	if resp.StatusCode == http.StatusConflict {
+	if errors.Is(err, apigee.ErrConflict) {
 		printf("kvm %s already exists", kvmName)
 		return nil
 	}
@@ -633,6 +1072,20 @@ func (p *provision) getOrCreateKVM(cred *credential, printf shared.FormatFn) err
 		return fmt.Errorf("creating kvm %s, status code: %v", kvmName, resp.StatusCode)
 	}
 	printf("kvm %s created", kvmName)
+	p.changes.add(fmt.Sprintf("kvm %s", kvmName), p.deleteKVM(kvmName))
+
+	if p.outputDir != "" {
+		certFile := filepath.Join(p.outputDir, fmt.Sprintf(certFileFormat, p.Org, p.Env))
+		keyFile := filepath.Join(p.outputDir, fmt.Sprintf(privateKeyFileFormat, p.Org, p.Env))
+		if err := shared.WriteFile(certFile, cert); err != nil {
+			return errors.Wrapf(err, "writing certificate to %s", certFile)
+		}
+		if err := shared.WriteFile(keyFile, privateKey); err != nil {
+			return errors.Wrapf(err, "writing private key to %s", keyFile)
+		}
+		printf("registered a new key and cert for JWTs, written to %s and %s", certFile, keyFile)
+		return nil
+	}
 
 	printf("registered a new key and cert for JWTs:\n")
 	printf("certificate:\n%s", cert)
@@ -650,7 +1103,7 @@ func (p *provision) createLegacyCredential(printf shared.FormatFn) (*credential,
 
 	credentialURL := fmt.Sprintf(legacyCredentialURLFormat, p.InternalProxyURL, p.Org, p.Env)
 
-	req, err := p.Client.NewRequest(http.MethodPost, credentialURL, cred)
+	req, err := p.Client.NewRequestWithContext(p.Context(), http.MethodPost, credentialURL, cred)
 	if err != nil {
 		return nil, err
 	}
@@ -667,6 +1120,7 @@ func (p *provision) createLegacyCredential(printf shared.FormatFn) (*credential,
 		return nil, fmt.Errorf("creating credential, status: %d", resp.StatusCode)
 	}
 	printf("credential created")
+	p.changes.add(fmt.Sprintf("credential %s", cred.Key), nil) // can't be revoked
 	return cred, nil
 }
 
@@ -686,7 +1140,16 @@ data:
 		xxxx...
 */
 func (p *provision) printConfig(cred *credential, printf shared.FormatFn, verifyErrors error) error {
+	configMapName := defaultConfigMapName
+	if p.multiEnv {
+		configMapName = fmt.Sprintf("%s-%s", configMapName, p.Env)
+	}
+	return writeConfig(p.newConfig(cred), "provision", configMapName, p.namespace, verifyErrors, printf)
+}
 
+// newConfig returns the apigee-remote-service-envoy config for the current
+// environment using cred
+func (p *provision) newConfig(cred *credential) server.Config {
 	config := server.Config{
 		Tenant: server.TenantConfig{
 			InternalAPI:      p.InternalProxyURL,
@@ -717,6 +1180,16 @@ func (p *provision) printConfig(cred *credential, printf shared.FormatFn, verify
 		config.Analytics.LegacyEndpoint = true
 	}
 
+	return config
+}
+
+// PrintConfig prints config for apigee-remote-service-envoy, noting that it
+// was generated by command. If namespace is set, it's printed as a ConfigMap.
+func PrintConfig(config server.Config, command, namespace string, printf shared.FormatFn) error {
+	return writeConfig(config, command, defaultConfigMapName, namespace, nil, printf)
+}
+
+func writeConfig(config server.Config, command, configMapName, namespace string, verifyErrors error, printf shared.FormatFn) error {
 	// encode config
 	var yamlBuffer bytes.Buffer
 	yamlEncoder := yaml.NewEncoder(&yamlBuffer)
@@ -729,7 +1202,7 @@ func (p *provision) printConfig(cred *credential, printf shared.FormatFn, verify
 
 	print := func(config string) error {
 		printf("# Configuration for apigee-remote-service-envoy")
-		printf("# generated by apigee-remote-service-cli provision on %s", time.Now().Format("2006-01-02 15:04:05"))
+		printf("# generated by apigee-remote-service-cli %s on %s", command, time.Now().Format("2006-01-02 15:04:05"))
 		if verifyErrors != nil {
 			printf("# WARNING: verification of provision failed. May not be valid.")
 		}
@@ -737,7 +1210,7 @@ func (p *provision) printConfig(cred *credential, printf shared.FormatFn, verify
 		return nil
 	}
 
-	if p.namespace == "" {
+	if namespace == "" {
 		return print(configYAML)
 	}
 
@@ -747,8 +1220,8 @@ func (p *provision) printConfig(cred *credential, printf shared.FormatFn, verify
 		APIVersion: "v1",
 		Kind:       "ConfigMap",
 		Metadata: shared.Metadata{
-			Name:      "apigee-remote-service-envoy",
-			Namespace: p.namespace,
+			Name:      configMapName,
+			Namespace: namespace,
 		},
 		Data: data,
 	}
@@ -770,9 +1243,9 @@ func (p *provision) checkAndDeployProxy(name, file string, printf shared.FormatF
 	var oldRev *apigee.Revision
 	var err error
 	if p.IsGCPManaged {
-		oldRev, err = p.Client.Proxies.GetGCPDeployedRevision(name)
+		oldRev, err = p.Client.Proxies.GetGCPDeployedRevisionWithContext(p.Context(), name)
 	} else {
-		oldRev, err = p.Client.Proxies.GetDeployedRevision(name)
+		oldRev, err = p.Client.Proxies.GetDeployedRevisionWithContext(p.Context(), name)
 	}
 	if err != nil {
 		return err
@@ -787,9 +1260,8 @@ func (p *provision) checkAndDeployProxy(name, file string, printf shared.FormatF
 	}
 
 	printf("checking proxy %s status...", name)
-	var resp *apigee.Response
-	proxy, resp, err := p.Client.Proxies.Get(name)
-	if err != nil && (resp == nil || resp.StatusCode != 404) {
+	proxy, _, err := p.Client.Proxies.GetWithContext(p.Context(), name)
+	if err != nil && !errors.Is(err, apigee.ErrNotFound) {
 		return err
 	}
 
@@ -797,6 +1269,22 @@ func (p *provision) checkAndDeployProxy(name, file string, printf shared.FormatF
 }
 
 func (p *provision) importAndDeployProxy(name string, proxy *apigee.Proxy, oldRev *apigee.Revision, file string, printf shared.FormatFn) error {
+	// proxies belong to the org, so import only once for all environments
+	newRev, ok := p.imported[name]
+	if ok {
+		printf("proxy %s revision %d already imported", name, newRev)
+	} else {
+		var err error
+		if newRev, err = p.importProxy(name, proxy, file, printf); err != nil {
+			return err
+		}
+	}
+
+	return p.deployProxy(name, oldRev, newRev, printf)
+}
+
+// importProxy imports the proxy file as a new revision
+func (p *provision) importProxy(name string, proxy *apigee.Proxy, file string, printf shared.FormatFn) (apigee.Revision, error) {
 	var newRev apigee.Revision = 1
 	if proxy != nil && len(proxy.Revisions) > 0 {
 		sort.Sort(apigee.RevisionSlice(proxy.Revisions))
@@ -812,37 +1300,48 @@ func (p *provision) importAndDeployProxy(name string, proxy *apigee.Proxy, oldRe
 		var err error
 		noDebugClient, err = apigee.NewEdgeClient(&opts)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
 	printf("creating new proxy %s revision: %d...", name, newRev)
-	_, res, err := noDebugClient.Proxies.Import(name, file)
+	_, res, err := noDebugClient.Proxies.ImportWithContext(p.Context(), name, file)
 	if res != nil {
 		defer res.Body.Close()
 	}
 	if err != nil {
-		return errors.Wrapf(err, "importing proxy %s", name)
+		return 0, errors.Wrapf(err, "importing proxy %s", name)
 	}
+	p.changes.add(fmt.Sprintf("proxy %s revision %d", name, newRev),
+		p.deleteRevision(name, newRev, newRev == 1))
+	p.imported[name] = newRev
+	return newRev, nil
+}
 
+// deployProxy deploys an imported proxy revision to the current environment
+func (p *provision) deployProxy(name string, oldRev *apigee.Revision, newRev apigee.Revision, printf shared.FormatFn) error {
+	var res *apigee.Response
+	var err error
 	if oldRev != nil && !p.IsGCPManaged { // it's not necessary to undeploy first with GCP
 		printf("undeploying proxy %s revision %d on env %s...",
 			name, oldRev, p.Env)
-		_, res, err = p.Client.Proxies.Undeploy(name, p.Env, *oldRev)
+		_, res, err = p.Client.Proxies.UndeployWithContext(p.Context(), name, p.Env, *oldRev)
 		if res != nil {
 			defer res.Body.Close()
 		}
 		if err != nil {
 			return errors.Wrapf(err, "undeploying proxy %s", name)
 		}
+		p.changes.add(fmt.Sprintf("undeployment of proxy %s revision %d", name, *oldRev),
+			p.redeploy(name, *oldRev))
 	}
 
 	if !p.IsGCPManaged {
 		cache := apigee.Cache{
 			Name: cacheName,
 		}
-		res, err = p.Client.CacheService.Create(cache)
-		if err != nil && (res == nil || res.StatusCode != http.StatusConflict) { // http.StatusConflict == already exists
+		res, err = p.Client.CacheService.CreateWithContext(p.Context(), cache)
+		if err != nil && !errors.Is(err, apigee.ErrConflict) {
 			return err
 		}
 		if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusConflict {
@@ -852,17 +1351,23 @@ func (p *provision) importAndDeployProxy(name string, proxy *apigee.Proxy, oldRe
 			printf("cache %s already exists", cacheName)
 		} else {
 			printf("cache %s created", cacheName)
+			p.changes.add(fmt.Sprintf("cache %s", cacheName), p.deleteCache(cacheName))
 		}
 	}
 
 	printf("deploying proxy %s revision %d to env %s...", name, newRev, p.Env)
-	_, res, err = p.Client.Proxies.Deploy(name, p.Env, newRev)
+	_, res, err = p.Client.Proxies.DeployWithContext(p.Context(), name, p.Env, newRev)
 	if res != nil {
 		defer res.Body.Close()
 	}
 	if err != nil {
 		return errors.Wrapf(err, "deploying proxy %s", name)
 	}
+	undo := p.undeploy(name, newRev)
+	if oldRev != nil && p.IsGCPManaged { // GCP replaced the old revision
+		undo = p.redeploy(name, *oldRev)
+	}
+	p.changes.add(fmt.Sprintf("deployment of proxy %s revision %d", name, newRev), undo)
 
 	return nil
 }
@@ -877,10 +1382,10 @@ func (p *provision) verifyInternalProxy(auth *apigee.EdgeAuth, printf shared.For
 	var res *apigee.Response
 	if p.IsOPDK {
 		analyticsURL := fmt.Sprintf(legacyAnalyticURLFormat, p.InternalProxyURL, p.Org, p.Env)
-		req, err = http.NewRequest(http.MethodPost, analyticsURL, strings.NewReader("{}"))
+		req, err = http.NewRequestWithContext(p.Context(), http.MethodPost, analyticsURL, strings.NewReader("{}"))
 	} else {
 		analyticsURL := fmt.Sprintf(analyticsURLFormat, p.InternalProxyURL, p.Org, p.Env)
-		req, err = http.NewRequest(http.MethodGet, analyticsURL, nil)
+		req, err = http.NewRequestWithContext(p.Context(), http.MethodGet, analyticsURL, nil)
 		q := req.URL.Query()
 		q.Add("tenant", fmt.Sprintf("%s~%s", p.Org, p.Env))
 		q.Add("relative_file_path", "fake")
@@ -889,10 +1394,11 @@ func (p *provision) verifyInternalProxy(auth *apigee.EdgeAuth, printf shared.For
 		req.URL.RawQuery = q.Encode()
 	}
 	if err != nil {
-		auth.ApplyTo(req)
-		res, err = p.Client.Do(req, nil)
-		if res != nil {
-			defer res.Body.Close()
+		if err = auth.ApplyTo(req); err == nil {
+			res, err = p.Client.Do(req, nil)
+			if res != nil {
+				defer res.Body.Close()
+			}
 		}
 	}
 	if err != nil {
@@ -909,11 +1415,13 @@ func (p *provision) verifyInternalProxy(auth *apigee.EdgeAuth, printf shared.For
 func (p *provision) verifyRemoteServiceProxy(auth *apigee.EdgeAuth, printf shared.FormatFn) error {
 
 	verifyGET := func(targetURL string) error {
-		req, err := http.NewRequest(http.MethodGet, targetURL, nil)
+		req, err := http.NewRequestWithContext(p.Context(), http.MethodGet, targetURL, nil)
 		if err != nil {
 			return errors.Wrapf(err, "creating request")
 		}
-		auth.ApplyTo(req)
+		if err := auth.ApplyTo(req); err != nil {
+			return err
+		}
 		res, err := p.Client.Do(req, nil)
 		if res != nil {
 			defer res.Body.Close()
@@ -933,27 +1441,29 @@ func (p *provision) verifyRemoteServiceProxy(auth *apigee.EdgeAuth, printf share
 
 	verifyAPIKeyURL := fmt.Sprintf(verifyAPIKeyURLFormat, p.RemoteServiceProxyURL)
 	body := fmt.Sprintf(`{ "apiKey": "%s" }`, auth.Username)
-	req, err := http.NewRequest(http.MethodPost, verifyAPIKeyURL, strings.NewReader(body))
+	req, err := http.NewRequestWithContext(p.Context(), http.MethodPost, verifyAPIKeyURL, strings.NewReader(body))
 	if err == nil {
 		req.Header.Add("Content-Type", "application/json")
-		auth.ApplyTo(req)
-		res, err = p.Client.Do(req, nil)
-		if res != nil {
-			defer res.Body.Close()
+		if err = auth.ApplyTo(req); err == nil {
+			res, err = p.Client.Do(req, nil)
+			if res != nil {
+				defer res.Body.Close()
+			}
 		}
 	}
-	if err != nil && (res == nil || res.StatusCode != 401) { // 401 is ok, we don't actually have a valid api key to test
+	if err != nil && !errors.Is(err, apigee.ErrUnauthorized) { // 401 is ok, we don't actually have a valid api key to test
 		verifyErrors = multierr.Append(verifyErrors, err)
 	}
 
 	quotasURL := fmt.Sprintf(quotasURLFormat, p.RemoteServiceProxyURL)
-	req, err = http.NewRequest(http.MethodPost, quotasURL, strings.NewReader("{}"))
+	req, err = http.NewRequestWithContext(p.Context(), http.MethodPost, quotasURL, strings.NewReader("{}"))
 	if err == nil {
 		req.Header.Add("Content-Type", "application/json")
-		auth.ApplyTo(req)
-		res, err = p.Client.Do(req, nil)
-		if res != nil {
-			defer res.Body.Close()
+		if err = auth.ApplyTo(req); err == nil {
+			res, err = p.Client.Do(req, nil)
+			if res != nil {
+				defer res.Body.Close()
+			}
 		}
 	}
 	if err != nil {
@@ -1101,17 +1611,6 @@ type developer struct {
 	UserName  string `json:"userName,omitempty"`
 }
 
-type application struct {
-	Name        string          `json:"name,omitempty"`
-	APIProducts []string        `json:"apiProducts,omitempty"`
-	Credentials []appCredential `json:"credentials,omitempty"`
-}
-
-type appCredential struct {
-	Key    string `json:"consumerKey,omitempty"`
-	Secret string `json:"consumerSecret,omitempty"`
-}
-
 type rotateRequest struct {
 	PrivateKey  string `json:"private_key"`
 	Certificate string `json:"certificate"`
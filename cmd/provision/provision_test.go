@@ -0,0 +1,544 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apigee/apigee-remote-service-cli/cmd"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+	"github.com/apigee/apigee-remote-service-cli/testutil"
+)
+
+// hybridServer is a hybrid management API of org with nothing provisioned.
+// It issues Google access tokens at /token and records the Authorization
+// header of each management request in auths.
+func hybridServer(auths *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			w.Write([]byte(`{"access_token": "/access/", "expires_in": 3600, "token_type": "Bearer"}`))
+			return
+		}
+		*auths = append(*auths, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+}
+
+// opdkServer is an OPDK management API and runtime of org with nothing
+// provisioned. It records non-GET requests in calls as "METHOD path?query"
+// and fails the call that matches fail.
+func opdkServer(calls *[]string, fail string) *httptest.Server {
+	created := map[string]bool{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+		if r.Method != http.MethodGet {
+			*calls = append(*calls, call)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case call == fail:
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && (strings.HasSuffix(r.URL.Path, "/caches") || strings.HasSuffix(r.URL.Path, "/keyvaluemaps")):
+			if created[r.URL.Path] {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			created[r.URL.Path] = true
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("{}"))
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+}
+
+// hybridProvisionServer is a hybrid management API and runtime of org with
+// the remote-service product, if product is not empty, and nothing else
+// provisioned. It records non-GET requests in calls as "METHOD path?query"
+// and their bodies in bodies.
+func hybridProvisionServer(calls *[]string, bodies map[string]string, product string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+		if r.Method != http.MethodGet {
+			*calls = append(*calls, call)
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies[call] = string(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case call == "GET /v1/organizations/org/apiproducts/remote-service?" && product != "":
+			w.Write([]byte(product))
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/"):
+			w.WriteHeader(http.StatusNotFound)
+		case call == "POST /v1/organizations/org/apiproducts?" && product != "":
+			w.WriteHeader(http.StatusConflict)
+		case call == "POST /v1/organizations/org/developers/dev@example.com/apps?":
+			w.Write([]byte(`{"name": "remote-service", "credentials": [{"consumerKey": "/key/", "consumerSecret": "/secret/"}]}`))
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+}
+
+// executeProvision runs provision with flags
+func executeProvision(print *testutil.TestPrint, flags ...string) error {
+	rootArgs := &shared.RootArgs{}
+	rootCmd := cmd.GetRootCmd(append([]string{"provision"}, flags...), print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+	return rootCmd.Execute()
+}
+
+func TestProvisionServiceAccount(t *testing.T) {
+
+	print := testutil.Printer("TestProvisionServiceAccount")
+
+	var auths []string
+	ts := hybridServer(&auths)
+	defer ts.Close()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "provision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	serviceAccount := filepath.Join(dir, "sa.json")
+	data, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "sa@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})),
+		"token_uri":    ts.URL + "/token",
+	})
+	if err := ioutil.WriteFile(serviceAccount, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err = executeProvision(print, "--dry-run", "--service-account", serviceAccount, "--management", ts.URL,
+		"--runtime", "/runtime/", "-o", "org", "-e", "env", "-d", "dev@example.com")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	if len(auths) == 0 {
+		t.Fatalf("want management requests, got none")
+	}
+	for _, auth := range auths {
+		if auth != "Bearer /access/" {
+			t.Errorf("want service account token, got: %q", auth)
+		}
+	}
+	if last := print.Prints[len(print.Prints)-1]; last != "dry run complete, no changes made" {
+		t.Errorf("want dry run complete, got: %s", last)
+	}
+}
+
+func TestProvisionAuthProviders(t *testing.T) {
+
+	print := testutil.Printer("TestProvisionAuthProviders")
+
+	var auths []string
+	ts := hybridServer(&auths)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "provision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("/file-token/\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	netrc := fmt.Sprintf("machine %s login /username/ password password\n", strings.TrimPrefix(ts.URL, "http://"))
+	if err := ioutil.WriteFile(filepath.Join(dir, ".netrc"), []byte(netrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv("APIGEE_TOKEN", os.Getenv("APIGEE_TOKEN"))
+	os.Setenv("APIGEE_TOKEN", "/env-token/")
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--auth-command", "echo /command-token/"}, "Bearer /command-token/"},
+		{[]string{"--auth-file", tokenFile}, "Bearer /file-token/"},
+		{[]string{"--auth", "env"}, "Bearer /env-token/"},
+		{[]string{"--auth", "netrc"}, "Basic L3VzZXJuYW1lLzpwYXNzd29yZA=="},
+	}
+	for _, test := range tests {
+		auths = nil
+		flags := append([]string{"--dry-run", "--management", ts.URL,
+			"--runtime", "/runtime/", "-o", "org", "-e", "env", "-d", "dev@example.com"}, test.args...)
+		if err := executeProvision(print, flags...); err != nil {
+			t.Errorf("%v want no error, got: %v", test.args, err)
+		}
+		if len(auths) == 0 {
+			t.Errorf("%v want management requests, got none", test.args)
+		}
+		for _, auth := range auths {
+			if auth != test.want {
+				t.Errorf("%v want auth %s, got: %s", test.args, test.want, auth)
+				break
+			}
+		}
+	}
+}
+
+func TestProvisionRollbackOPDK(t *testing.T) {
+
+	// the rollback is printed to stderr, not with the config
+	print := testutil.Printer("TestProvisionRollbackOPDK")
+	failuref = print.Printf
+	defer func() { failuref = shared.Errorf }()
+	stdout := testutil.Printer("TestProvisionRollbackOPDK")
+
+	var calls []string
+	ts := opdkServer(&calls, "POST /v1/organizations/org/environments/env2/keyvaluemaps?")
+	defer ts.Close()
+
+	err := executeProvision(stdout, "--opdk", "--runtime", ts.URL, "-o", "org", "-e", "env1,env2",
+		"-u", "/username/", "-p", "password")
+	if err == nil || !strings.Contains(err.Error(), "environment env2") {
+		t.Fatalf("want env2 error, got: %v", err)
+	}
+
+	// the credentials can't be revoked
+	wantCalls := []string{
+		"POST /v1/organizations/org/apis/remote-service/revisions/1/deployments?action=undeploy&env=env2",
+		"POST /v1/organizations/org/apis/edgemicro-internal/revisions/1/deployments?action=undeploy&env=env2",
+		"DELETE /v1/organizations/org/environments/env2/caches/remote-service?",
+		"DELETE /v1/organizations/org/environments/env1/keyvaluemaps/remote-service?",
+		"POST /v1/organizations/org/apis/remote-service/revisions/1/deployments?action=undeploy&env=env1",
+		"DELETE /v1/organizations/org/apis/remote-service?",
+		"POST /v1/organizations/org/apis/edgemicro-internal/revisions/1/deployments?action=undeploy&env=env1",
+		"DELETE /v1/organizations/org/environments/env1/caches/remote-service?",
+		"DELETE /v1/organizations/org/apis/edgemicro-internal?",
+	}
+	if got := calls[len(calls)-len(wantCalls):]; !reflect.DeepEqual(wantCalls, got) {
+		t.Errorf("want rollback calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(got, "\n"))
+	}
+
+	wants := []string{
+		"provisioning failed, rolling back changes...",
+		"rolling back deployment of proxy remote-service revision 1...",
+		"rolling back deployment of proxy edgemicro-internal revision 1...",
+		"rolling back cache remote-service...",
+		"rolling back kvm remote-service...",
+		"rolling back deployment of proxy remote-service revision 1...",
+		"rolling back proxy remote-service revision 1...",
+		"rolling back deployment of proxy edgemicro-internal revision 1...",
+		"rolling back cache remote-service...",
+		"rolling back proxy edgemicro-internal revision 1...",
+		"the following were left behind:",
+	}
+	checkLeftBehind(t, print, wants, 2)
+	stdout.Check(t, nil)
+}
+
+func TestProvisionNoRollbackOPDK(t *testing.T) {
+
+	// the rollback is printed to stderr, not with the config
+	print := testutil.Printer("TestProvisionNoRollbackOPDK")
+	failuref = print.Printf
+	defer func() { failuref = shared.Errorf }()
+	stdout := testutil.Printer("TestProvisionNoRollbackOPDK")
+
+	var calls []string
+	ts := opdkServer(&calls, "POST /v1/organizations/org/environments/env/keyvaluemaps?")
+	defer ts.Close()
+
+	err := executeProvision(stdout, "--no-rollback", "--opdk", "--runtime", ts.URL, "-o", "org", "-e", "env",
+		"-u", "/username/", "-p", "password")
+	if err == nil || !strings.Contains(err.Error(), "retrieving or creating kvm") {
+		t.Fatalf("want kvm error, got: %v", err)
+	}
+	if last := calls[len(calls)-1]; last != "POST /v1/organizations/org/environments/env/keyvaluemaps?" {
+		t.Errorf("want no changes after the failure, got: %s", last)
+	}
+
+	wants := []string{
+		"provisioning failed, not rolling back (--no-rollback)",
+		"the following were left behind:",
+		"  proxy edgemicro-internal revision 1",
+		"  cache remote-service",
+		"  deployment of proxy edgemicro-internal revision 1",
+		"  proxy remote-service revision 1",
+		"  deployment of proxy remote-service revision 1",
+	}
+	checkLeftBehind(t, print, wants, 1)
+	stdout.Check(t, nil)
+}
+
+func TestProvisionExistingKVMOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestProvisionExistingKVMOPDK")
+
+	var calls []string
+	api := opdkServer(&calls, "")
+	defer api.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/v1/organizations/org/environments/env/keyvaluemaps/remote-service" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name": "remote-service", "encrypted": true}`))
+			return
+		}
+		api.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	err := executeProvision(print, "--opdk", "--runtime", ts.URL, "-o", "org", "-e", "env",
+		"-u", "/username/", "-p", "password")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	// the existing kvm and its key are kept
+	for _, call := range calls {
+		if strings.Contains(call, "keyvaluemaps") {
+			t.Errorf("want kvm unchanged, got: %s", call)
+		}
+	}
+	for _, p := range print.Prints {
+		if strings.Contains(p, "registered a new key") {
+			t.Errorf("want no new key, got: %s", p)
+		}
+	}
+}
+
+func TestProvisionVerifyFailedOPDK(t *testing.T) {
+
+	print := testutil.Printer("TestProvisionVerifyFailedOPDK")
+
+	var calls []string
+	ts := opdkServer(&calls, "POST /remote-service/verifyApiKey?")
+	defer ts.Close()
+
+	err := executeProvision(print, "--opdk", "--runtime", ts.URL, "-o", "org", "-e", "env",
+		"-u", "/username/", "-p", "password")
+	if err != errVerificationFailed || shared.ExitCode(err) != 1 {
+		t.Fatalf("want verification failed error with exit code 1, got: %v", err)
+	}
+
+	// the config is output and nothing is rolled back
+	if len(print.Prints) != 4 || !strings.Contains(print.Prints[2], "verification of provision failed") {
+		t.Errorf("want config with a warning, got:\n%s", strings.Join(print.Prints, "\n"))
+	}
+	if last := calls[len(calls)-1]; last != "POST /remote-service/quotas?" {
+		t.Errorf("want no changes after verification, got: %s", last)
+	}
+}
+
+// checkLeftBehind checks that print has wants followed by the given number of
+// credentials, which have random keys
+func checkLeftBehind(t *testing.T, print *testutil.TestPrint, wants []string, credentials int) {
+	t.Helper()
+	if len(print.Prints) != len(wants)+credentials {
+		t.Fatalf("want %d prints, got:\n%s", len(wants)+credentials, strings.Join(print.Prints, "\n"))
+	}
+	for _, cred := range print.Prints[len(wants):] {
+		if !strings.HasPrefix(cred, "  credential ") {
+			t.Errorf("want credential left behind, got: %s", cred)
+		}
+	}
+	print.Prints = print.Prints[:len(wants)]
+	print.Check(t, wants)
+}
+
+func TestProvisionDryRun(t *testing.T) {
+
+	print := testutil.Printer("TestProvisionDryRun")
+
+	// dry run must not change anything
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("want only GET requests, got: %s %s", r.Method, r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/organizations/org/environments" {
+			w.Write([]byte(`["env1", "env2"]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "provision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outputDir := filepath.Join(dir, "output")
+
+	hybrid := []string{"--management", ts.URL, "--runtime", "/runtime/", "-o", "org", "-t", "/token/", "-d", "dev@example.com"}
+	opdk := []string{"--opdk", "--runtime", ts.URL, "-o", "org", "-u", "/username/", "-p", "password"}
+	tests := [][]string{
+		append([]string{"-e", "env"}, hybrid...),
+		append([]string{"-e", "env1,env2"}, hybrid...),
+		append([]string{"--all-environments"}, hybrid...),
+		append([]string{"-e", "env1,env2", "--emit", "kubernetes", "--output-dir", outputDir}, hybrid...),
+		append([]string{"-e", "env", "--emit", "kustomize", "--output-dir", outputDir}, hybrid...),
+		append([]string{"-e", "env", "--output-file", filepath.Join(outputDir, "config.yaml")}, hybrid...),
+		append([]string{"-e", "env"}, opdk...),
+		append([]string{"-e", "env1,env2", "--emit", "helm", "--output-dir", outputDir}, opdk...),
+	}
+	for _, flags := range tests {
+		print.Prints = nil
+		if err := executeProvision(print, append([]string{"--dry-run"}, flags...)...); err != nil {
+			t.Errorf("%v want no error, got: %v", flags, err)
+			continue
+		}
+		if last := print.Prints[len(print.Prints)-1]; last != "dry run complete, no changes made" {
+			t.Errorf("%v want dry run complete, got: %s", flags, last)
+		}
+		if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+			t.Errorf("%v want no output written, got: %v", flags, err)
+		}
+	}
+
+	// each env is planned, the proxies are imported only once
+	wants := []string{
+		"plan for provisioning org org env env1 (dry run, no changes will be made):",
+		"  proxy edgemicro-internal: would import revision 1",
+		"  proxy edgemicro-internal: would deploy revision 1 to env1",
+		"  proxy remote-service: would import revision 1",
+		"  proxy remote-service: would deploy revision 1 to env1",
+		"  cache remote-service: would create",
+		"  credential: would create a new key and secret",
+		"  kvm remote-service: would create with a new key and certificate",
+		"plan for provisioning org org env env2 (dry run, no changes will be made):",
+		"  proxy edgemicro-internal: would deploy revision 1 to env2",
+		"  proxy remote-service: would deploy revision 1 to env2",
+		"  cache remote-service: would create",
+		"  credential: would create a new key and secret",
+		"  kvm remote-service: would create with a new key and certificate",
+		"dry run complete, no changes made",
+	}
+	print.Check(t, wants)
+}
+
+func TestProvisionMultiEnv(t *testing.T) {
+
+	print := testutil.Printer("TestProvisionMultiEnv")
+
+	var calls []string
+	bodies := map[string]string{}
+	ts := hybridProvisionServer(&calls, bodies, "")
+	defer ts.Close()
+
+	err := executeProvision(print, "--management", ts.URL, "--runtime", ts.URL, "-o", "org", "-e", "env1,env2",
+		"-t", "/token/", "-d", "dev@example.com")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	// the proxy is imported once, the credential created once for both envs
+	wantCalls := []string{
+		"POST /v1/organizations/org/apis?action=import&name=remote-service",
+		"POST /v1/organizations/org/environments/env1/apis/remote-service/revisions/1/deployments?override=true",
+		"POST /v1/organizations/org/apiproducts?",
+		"POST /v1/organizations/org/developers?",
+		"POST /v1/organizations/org/developers/dev@example.com/apps?",
+		"POST /remote-service/verifyApiKey?",
+		"POST /remote-service/quotas?",
+		"POST /v1/organizations/org/environments/env2/apis/remote-service/revisions/1/deployments?override=true",
+		"POST /remote-service/verifyApiKey?",
+		"POST /remote-service/quotas?",
+	}
+	if !reflect.DeepEqual(wantCalls, calls) {
+		t.Errorf("want calls:\n%s\ngot:\n%s", strings.Join(wantCalls, "\n"), strings.Join(calls, "\n"))
+	}
+
+	var product struct{ Environments []string }
+	json.Unmarshal([]byte(bodies["POST /v1/organizations/org/apiproducts?"]), &product)
+	if want := []string{"env1", "env2"}; !reflect.DeepEqual(want, product.Environments) {
+		t.Errorf("want product environments %v, got: %v", want, product.Environments)
+	}
+}
+
+func TestProvisionMultiEnvExistingProduct(t *testing.T) {
+
+	print := testutil.Printer("TestProvisionMultiEnvExistingProduct")
+
+	var calls []string
+	bodies := map[string]string{}
+	ts := hybridProvisionServer(&calls, bodies,
+		`{"name": "remote-service", "environments": ["env1", "other"], "quota": "10"}`)
+	defer ts.Close()
+
+	err := executeProvision(print, "--management", ts.URL, "--runtime", ts.URL, "-o", "org", "-e", "env1,env2",
+		"-t", "/token/", "-d", "dev@example.com")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	// the missing env is added, other fields are kept
+	update := "PUT /v1/organizations/org/apiproducts/remote-service?"
+	if calls[3] != update {
+		t.Fatalf("want product updated, got calls:\n%s", strings.Join(calls, "\n"))
+	}
+	var product map[string]interface{}
+	json.Unmarshal([]byte(bodies[update]), &product)
+	want := map[string]interface{}{
+		"name":         "remote-service",
+		"environments": []interface{}{"env1", "other", "env2"},
+		"quota":        "10",
+	}
+	if !reflect.DeepEqual(want, product) {
+		t.Errorf("want product %v, got: %v", want, product)
+	}
+
+	// and planned by a dry run
+	print.Prints = nil
+	err = executeProvision(print, "--dry-run", "--management", ts.URL, "--runtime", ts.URL, "-o", "org",
+		"-e", "env1,env2", "-t", "/token/", "-d", "dev@example.com")
+	if err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+	wants := []string{
+		"plan for provisioning org org env env1 (dry run, no changes will be made):",
+		"  proxy remote-service: would import revision 1",
+		"  proxy remote-service: would deploy revision 1 to env1",
+		"  product remote-service: exists, would reuse",
+		"  developer dev@example.com: would create",
+		"  app remote-service: would create",
+		"  product remote-service: would add environments env2",
+		"  credential: would use the key and secret of the new app remote-service",
+		"plan for provisioning org org env env2 (dry run, no changes will be made):",
+		"  proxy remote-service: would deploy revision 1 to env2",
+		"dry run complete, no changes made",
+	}
+	print.Check(t, wants)
+}
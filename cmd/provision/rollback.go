@@ -0,0 +1,187 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+	"github.com/apigee/apigee-remote-service-cli/shared"
+)
+
+// changes records what provisioning has changed so that it can be undone if
+// a later step fails
+type changes struct {
+	list []change
+}
+
+type change struct {
+	desc string
+	undo func(ctx context.Context) error // nil if the change can't be undone
+}
+
+// add records a change. undo may be nil if the change can't be undone.
+func (c *changes) add(desc string, undo func(ctx context.Context) error) {
+	c.list = append(c.list, change{desc: desc, undo: undo})
+}
+
+// rollback undoes the changes in reverse order and returns the descriptions
+// of those that remain
+func (c *changes) rollback(ctx context.Context, printf shared.FormatFn) []string {
+	var remaining []string
+	for i := len(c.list) - 1; i >= 0; i-- {
+		ch := c.list[i]
+		if ch.undo == nil {
+			remaining = append(remaining, ch.desc)
+			continue
+		}
+		printf("rolling back %s...", ch.desc)
+		if err := ch.undo(ctx); err != nil {
+			printf("unable to roll back %s: %v", ch.desc, err)
+			remaining = append(remaining, ch.desc)
+		}
+	}
+	c.list = nil
+	return remaining
+}
+
+// descriptions returns the descriptions of all changes in the order made
+func (c *changes) descriptions() []string {
+	descs := make([]string, 0, len(c.list))
+	for _, ch := range c.list {
+		descs = append(descs, ch.desc)
+	}
+	return descs
+}
+
+// failuref prints the handling of a failure to stderr, so that it isn't mixed
+// with the config
+var failuref shared.FormatFn = shared.Errorf
+
+// handleFailure rolls back the changes made by a failed provision, unless
+// --no-rollback was specified, and prints what was left behind
+func (p *provision) handleFailure(printf shared.FormatFn) {
+	if len(p.changes.list) == 0 {
+		return
+	}
+
+	var remaining []string
+	if p.noRollback {
+		printf("provisioning failed, not rolling back (--no-rollback)")
+		remaining = p.changes.descriptions()
+	} else {
+		printf("provisioning failed, rolling back changes...")
+		// the command's context may have been cancelled by interrupt
+		remaining = p.changes.rollback(context.Background(), printf)
+	}
+
+	if len(remaining) == 0 {
+		printf("all changes rolled back")
+		return
+	}
+	printf("the following were left behind:")
+	for _, desc := range remaining {
+		printf("  %s", desc)
+	}
+}
+
+// deleteResource returns an undo func that deletes a management API resource
+func (p *provision) deleteResource(path string) func(ctx context.Context) error {
+	client := p.Client // p.Client is replaced to verify with the new credential
+	return func(ctx context.Context) error {
+		req, err := client.NewRequestNoEnvWithContext(ctx, http.MethodDelete, path, nil)
+		if err != nil {
+			return err
+		}
+		_, err = client.Do(req, nil)
+		return err
+	}
+}
+
+// updateResource returns an undo func that replaces a management API
+// resource with v
+func (p *provision) updateResource(path string, v interface{}) func(ctx context.Context) error {
+	client := p.Client
+	return func(ctx context.Context) error {
+		req, err := client.NewRequestNoEnvWithContext(ctx, http.MethodPut, path, v)
+		if err != nil {
+			return err
+		}
+		_, err = client.Do(req, nil)
+		return err
+	}
+}
+
+// undeploy returns an undo func that undeploys a proxy revision
+func (p *provision) undeploy(name string, rev apigee.Revision) func(ctx context.Context) error {
+	client, env := p.Client, p.Env
+	return func(ctx context.Context) error {
+		_, res, err := client.Proxies.UndeployWithContext(ctx, name, env, rev)
+		if res != nil {
+			res.Body.Close()
+		}
+		return err
+	}
+}
+
+// redeploy returns an undo func that deploys a previous proxy revision
+func (p *provision) redeploy(name string, rev apigee.Revision) func(ctx context.Context) error {
+	client, env := p.Client, p.Env
+	return func(ctx context.Context) error {
+		_, res, err := client.Proxies.DeployWithContext(ctx, name, env, rev)
+		if res != nil {
+			res.Body.Close()
+		}
+		return err
+	}
+}
+
+// deleteRevision returns an undo func that deletes an imported proxy
+// revision, or the proxy if the revision was its first
+func (p *provision) deleteRevision(name string, rev apigee.Revision, first bool) func(ctx context.Context) error {
+	client := p.Client
+	return func(ctx context.Context) error {
+		var res *apigee.Response
+		var err error
+		if first {
+			_, res, err = client.Proxies.DeleteWithContext(ctx, name)
+		} else {
+			_, res, err = client.Proxies.DeleteRevisionWithContext(ctx, name, rev)
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		return err
+	}
+}
+
+// deleteKVM returns an undo func that deletes the kvm of the current env
+func (p *provision) deleteKVM(name string) func(ctx context.Context) error {
+	client := p.Client
+	return func(ctx context.Context) error {
+		_, err := client.KVMService.DeleteWithContext(ctx, name)
+		return err
+	}
+}
+
+// deleteCache returns an undo func that deletes the cache of the current env
+func (p *provision) deleteCache(name string) func(ctx context.Context) error {
+	client := p.Client
+	return func(ctx context.Context) error {
+		_, err := client.CacheService.DeleteWithContext(ctx, name)
+		return err
+	}
+}
@@ -16,23 +16,18 @@ package token
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"sort"
+	"path/filepath"
 	"time"
 
+	"github.com/apigee/apigee-remote-service-cli/apigee"
 	"github.com/apigee/apigee-remote-service-cli/cmd/provision"
 	"github.com/apigee/apigee-remote-service-cli/shared"
-	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jws"
 	"github.com/lestrrat-go/jwx/jwt"
@@ -46,15 +41,9 @@ const (
 	certsURLFormat         = "%s/certs"  // RemoteServiceProxyURL
 	rotateURLFormat        = "%s/rotate" // RemoteServiceProxyURL
 	clientCredentialsGrant = "client_credentials"
-	policySecretNameFormat = "%s-%s-policy-secret"
 	commonName             = "apigee-remote-service"
 	orgName                = "Google LLC"
-
-	// hybrid forces specific file extensions! https://docs.apigee.com/hybrid/v1.2/k8s-secrets
-	jwksSecretKey       = "remote-service.crt" // obviously not a .crt, but hybrid will treat as blob
-	keySecretKey        = "remote-service.key"
-	kidSecretKey        = "remote-service.properties"
-	kidSecretPropFormat = "kid=%s" // KID
+	helmValuesFileName     = "values.yaml" // for --emit helm --output-dir
 )
 
 type token struct {
@@ -67,6 +56,9 @@ type token struct {
 	certKeyStrength       int
 	namespace             string
 	truncate              int
+	emit                  string
+	outputDir             string
+	outputFile            string
 }
 
 // Cmd returns base command
@@ -141,18 +133,29 @@ func cmdCreateSecret(t *token, printf shared.FormatFn) *cobra.Command {
 	c := &cobra.Command{
 		Use:   "create-secret",
 		Short: "create Kubernetes CRDs for JWT tokens (hybrid only)",
-		Long:  "Creates a new Kubernetes Secret CRD for JWT tokens, maintains prior cert(s) for rotation.",
-		Args:  cobra.NoArgs,
+		Long: `Creates a new Kubernetes Secret CRD for JWT tokens, maintains prior cert(s) for rotation.
+Use --output-file or --output-dir to write the Secret to a file readable only by the user.`,
+		Args: cobra.NoArgs,
+
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if t.emit != "" && t.emit != shared.EmitHelm && t.emit != shared.EmitKustomize {
+				return fmt.Errorf("unknown --emit format %q, must be one of: %s, %s",
+					t.emit, shared.EmitHelm, shared.EmitKustomize)
+			}
+			if t.emit == shared.EmitKustomize && t.outputDir == "" {
+				return fmt.Errorf("--emit kustomize requires --output-dir")
+			}
+			if t.outputFile != "" && t.outputDir != "" {
+				return fmt.Errorf("--output-file and --output-dir are mutually exclusive")
+			}
+			cmd.SilenceUsage = true
 
-		Run: func(cmd *cobra.Command, _ []string) {
 			if t.ServerConfig != nil {
 				t.clientID = t.ServerConfig.Tenant.Key
 				t.clientSecret = t.ServerConfig.Tenant.Secret
 			}
 
-			t.keyID = time.Now().Format(time.RFC3339)
-
-			t.createSecret(printf)
+			return t.createSecret(printf)
 		},
 	}
 
@@ -161,6 +164,12 @@ func cmdCreateSecret(t *token, printf shared.FormatFn) *cobra.Command {
 
 	c.Flags().StringVarP(&t.namespace, "namespace", "n", "apigee", "emit Secret in the specified namespace")
 	c.Flags().IntVarP(&t.truncate, "truncate", "", 2, "number of certs to keep in jwks")
+	c.Flags().StringVarP(&t.emit, "emit", "", "",
+		"emit the Secret as helm (values) or kustomize (base) rather than a manifest")
+	c.Flags().StringVarP(&t.outputFile, "output-file", "", "",
+		"write the Secret (or --emit helm values) to a file rather than stdout")
+	c.Flags().StringVarP(&t.outputDir, "output-dir", "", "",
+		"write the Secret (or --emit output) to files in a directory")
 
 	return c
 }
@@ -219,7 +228,7 @@ func (t *token) createToken(printf shared.FormatFn) (string, error) {
 	json.NewEncoder(body).Encode(tokenReq)
 
 	tokenURL := fmt.Sprintf(tokenURLFormat, t.RemoteServiceProxyURL)
-	req, err := http.NewRequest(http.MethodPost, tokenURL, body)
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, tokenURL, body)
 	if err != nil {
 		return "", errors.Wrap(err, "creating request")
 	}
@@ -313,7 +322,7 @@ func (t *token) rotateCert(printf shared.FormatFn) error {
 	}
 
 	rotateURL := fmt.Sprintf(rotateURLFormat, t.RemoteServiceProxyURL)
-	req, err := http.NewRequest(http.MethodPost, rotateURL, body)
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, rotateURL, body)
 	if err != nil {
 		return errors.Wrap(err, "creating request")
 	}
@@ -323,7 +332,7 @@ func (t *token) rotateCert(printf shared.FormatFn) error {
 
 	resp, err := t.Client.Do(req, nil)
 	if err != nil {
-		if resp != nil && resp.StatusCode == 401 {
+		if errors.Is(err, apigee.ErrUnauthorized) {
 			return errors.Wrap(err, "authentication failed, check your key and secret")
 		}
 		return errors.Wrap(err, "rotating cert")
@@ -331,7 +340,9 @@ func (t *token) rotateCert(printf shared.FormatFn) error {
 	defer resp.Body.Close()
 
 	verbosef("new certificate:\n%s", cert)
-	verbosef("new private key:\n%s", privateKey)
+	if t.UnsafeDebug {
+		verbosef("new private key:\n%s", privateKey)
+	}
 
 	printf("certificate successfully rotated")
 	return nil
@@ -341,92 +352,71 @@ func (t *token) rotateCert(printf shared.FormatFn) error {
 func (t *token) createSecret(printf shared.FormatFn) error {
 	var verbosef = shared.NoPrintf
 	if t.Verbose {
-		verbosef = printf
+		verbosef = shared.Errorf // keep diagnostics out of the generated Secret
 	}
 
-	jwkSet := &jwk.Set{}
-	verbosef("retrieving existing certificates...")
-
-	var err error
-	if t.truncate > 1 { // if 1, just skip old stuff
-		// old jwks
-		jwksURL := fmt.Sprintf(certsURLFormat, t.RemoteServiceProxyURL)
-		jwkSet, err = jwk.FetchHTTP(jwksURL)
-		if err != nil {
-			return errors.Wrap(err, "fetching jwks")
-		}
-		jwksBytes, err := json.Marshal(jwkSet)
-		if err != nil {
-			return errors.Wrap(err, "marshalling JSON")
-		}
-		verbosef("old jkws...\n%s", string(jwksBytes))
-	}
-
-	t.keyID = time.Now().Format(time.RFC3339)
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	jwksURL := fmt.Sprintf(certsURLFormat, t.RemoteServiceProxyURL)
+	crd, err := provision.NewPolicySecret(t.Context(), t.Client, t.Org, t.Env, t.namespace, jwksURL, t.truncate, verbosef)
 	if err != nil {
-		return errors.Wrap(err, "generating key")
+		return err
 	}
 
-	// jwks
-	key, err := jwk.New(&privateKey.PublicKey)
+	// encode as YAML
+	var yamlBuffer bytes.Buffer
+	yamlEncoder := yaml.NewEncoder(&yamlBuffer)
+	yamlEncoder.SetIndent(2)
+	err = yamlEncoder.Encode(crd)
 	if err != nil {
-		return errors.Wrap(err, "generating jwks")
+		return errors.Wrap(err, "encoding YAML")
 	}
-	key.Set(jwk.KeyIDKey, t.keyID)
-	key.Set(jwk.AlgorithmKey, jwa.RS256.String())
-
-	jwkSet.Keys = append(jwkSet.Keys, key)
 
-	// sort increasing and truncate
-	sort.Sort(sort.Reverse(byKID(jwkSet.Keys)))
-	if t.truncate > 0 {
-		jwkSet.Keys = jwkSet.Keys[:t.truncate]
+	if t.emit == shared.EmitKustomize {
+		files := map[string]string{
+			shared.KustomizeFileName(crd.Kind, crd.Metadata.Name): yamlBuffer.String(),
+		}
+		if err := shared.WriteKustomizeBase(t.outputDir, files); err != nil {
+			return errors.Wrapf(err, "writing kustomize base to %s", t.outputDir)
+		}
+		printf("kustomize base written to %s", t.outputDir)
+		return nil
 	}
 
-	jwksBytes, err := json.Marshal(jwkSet)
-	if err != nil {
-		return errors.Wrap(err, "marshalling JSON")
+	out := printf
+	var output bytes.Buffer
+	outputFile := t.outputFile
+	if t.outputDir != "" {
+		outputFile = filepath.Join(t.outputDir, shared.KustomizeFileName(crd.Kind, crd.Metadata.Name))
+		if t.emit == shared.EmitHelm {
+			outputFile = filepath.Join(t.outputDir, helmValuesFileName)
+		}
 	}
-	verbosef("new jkws...\n%s", string(jwksBytes))
-
-	// private key
-	keyBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
-
-	// kid
-	kidProp := fmt.Sprintf(kidSecretPropFormat, t.keyID)
-
-	// Secret CRD
-	data := map[string]string{
-		jwksSecretKey: base64.StdEncoding.EncodeToString(jwksBytes),
-		keySecretKey:  base64.StdEncoding.EncodeToString(keyBytes),
-		kidSecretKey:  base64.StdEncoding.EncodeToString([]byte(kidProp)),
+	if outputFile != "" {
+		out = shared.WriterFormatFn(&output)
 	}
 
-	crd := shared.KubernetesCRD{
-		APIVersion: "v1",
-		Kind:       "Secret",
-		Type:       "Opaque",
-		Metadata: shared.Metadata{
-			Name:      fmt.Sprintf(policySecretNameFormat, t.Org, t.Env),
-			Namespace: t.namespace,
-		},
-		Data: data,
+	if t.emit == shared.EmitHelm {
+		err = shared.PrintHelmValues([]shared.KubernetesCRD{crd}, "token create-secret", out)
+		if err != nil {
+			return err
+		}
+	} else {
+		out("# Secret for apigee-remote-service-envoy")
+		out("# generated by apigee-remote-service-cli token create-secret on %s", time.Now().Format("2006-01-02 15:04:05"))
+		out("%s", yamlBuffer.String())
 	}
 
-	// encode as YAML
-	var yamlBuffer bytes.Buffer
-	yamlEncoder := yaml.NewEncoder(&yamlBuffer)
-	yamlEncoder.SetIndent(2)
-	err = yamlEncoder.Encode(crd)
-	if err != nil {
-		return errors.Wrap(err, "encoding YAML")
+	if outputFile == "" {
+		return nil
 	}
-
-	printf("# Secret for apigee-remote-service-envoy")
-	printf("# generated by apigee-remote-service-cli provision on %s", time.Now().Format("2006-01-02 15:04:05"))
-	printf(yamlBuffer.String())
+	if t.outputDir != "" {
+		if err := os.MkdirAll(t.outputDir, 0700); err != nil {
+			return errors.Wrapf(err, "creating output dir %s", t.outputDir)
+		}
+	}
+	if err := shared.WriteFile(outputFile, output.String()); err != nil {
+		return errors.Wrapf(err, "writing secret to %s", outputFile)
+	}
+	printf("secret written to %s", outputFile)
 	return nil
 }
 
@@ -445,9 +435,3 @@ type tokenRequest struct {
 type tokenResponse struct {
 	Token string `json:"token"`
 }
-
-type byKID []jwk.Key
-
-func (a byKID) Len() int           { return len(a) }
-func (a byKID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byKID) Less(i, j int) bool { return a[i].KeyID() < a[j].KeyID() }
@@ -18,8 +18,11 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -113,6 +116,85 @@ func TestTokenInspect(t *testing.T) {
 	print.Check(t, want)
 }
 
+func TestTokenCreateSecretKustomize(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "kustomize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	print := testutil.Printer("TestTokenCreateSecretKustomize")
+
+	rootArgs := &shared.RootArgs{}
+	flags := []string{"token", "create-secret", "--runtime", "https://org-env.apigee.net",
+		"-o", "org", "-e", "env", "--truncate", "1", "--emit", "kustomize", "--output-dir", dir}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	print.Check(t, []string{"kustomize base written to " + dir})
+
+	kustomization, err := ioutil.ReadFile(filepath.Join(dir, "kustomization.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretFile := "org-env-policy-secret-secret.yaml"
+	if !strings.Contains(string(kustomization), "- "+secretFile) {
+		t.Errorf("want %s in resources, got:\n%s", secretFile, kustomization)
+	}
+	info, err := os.Stat(filepath.Join(dir, secretFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("want secret file mode 0600, got: %v", info.Mode().Perm())
+	}
+}
+
+func TestTokenCreateSecretOutputFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outputFile := filepath.Join(dir, "secret.yaml")
+
+	print := testutil.Printer("TestTokenCreateSecretOutputFile")
+
+	rootArgs := &shared.RootArgs{}
+	flags := []string{"token", "create-secret", "--runtime", "https://org-env.apigee.net",
+		"-o", "org", "-e", "env", "--truncate", "1", "--output-file", outputFile}
+	rootCmd := cmd.GetRootCmd(flags, print.Printf)
+	shared.AddCommandWithFlags(rootCmd, rootArgs, Cmd(rootArgs, print.Printf))
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("want no error: %v", err)
+	}
+
+	print.Check(t, []string{"secret written to " + outputFile})
+
+	info, err := os.Stat(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("want secret file mode 0600, got: %v", info.Mode().Perm())
+	}
+	secret, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(secret), "# Secret for apigee-remote-service-envoy\n") ||
+		!strings.Contains(string(secret), "name: org-env-policy-secret") {
+		t.Errorf("want Secret in file, got:\n%s", secret)
+	}
+}
+
 func generateJWT(privateKey *rsa.PrivateKey) (string, error) {
 
 	token := jwt.New()
@@ -14,6 +14,7 @@ require (
 	github.com/lestrrat-go/jwx v0.9.1
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.3
 	go.uber.org/multierr v1.5.0
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -15,10 +15,15 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	"github.com/apigee/apigee-remote-service-cli/cmd"
 	"github.com/apigee/apigee-remote-service-cli/cmd/bindings"
+	"github.com/apigee/apigee-remote-service-cli/cmd/credentials"
+	"github.com/apigee/apigee-remote-service-cli/cmd/deprovision"
+	"github.com/apigee/apigee-remote-service-cli/cmd/login"
+	"github.com/apigee/apigee-remote-service-cli/cmd/products"
 	"github.com/apigee/apigee-remote-service-cli/cmd/provision"
 	"github.com/apigee/apigee-remote-service-cli/cmd/token"
 	"github.com/apigee/apigee-remote-service-cli/shared"
@@ -43,12 +48,28 @@ func main() {
 
 	rootCmd := cmd.GetRootCmd(os.Args[1:], shared.Printf)
 
+	ctx, stop := shared.InterruptContext(context.Background())
+	defer stop()
+
 	rootArgs := &shared.RootArgs{}
+	rootArgs.SetContext(ctx)
 	shared.AddCommandWithFlags(rootCmd, rootArgs, provision.Cmd(rootArgs, shared.Printf))
+	shared.AddCommandWithFlags(rootCmd, rootArgs, deprovision.Cmd(rootArgs, shared.Printf))
+	shared.AddCommandWithFlags(rootCmd, rootArgs, credentials.Cmd(rootArgs, shared.Printf))
 	shared.AddCommandWithFlags(rootCmd, rootArgs, bindings.Cmd(rootArgs, shared.Printf))
+	shared.AddCommandWithFlags(rootCmd, rootArgs, products.Cmd(rootArgs, shared.Printf))
 	shared.AddCommandWithFlags(rootCmd, rootArgs, token.Cmd(rootArgs, shared.Printf))
+	shared.AddCommandWithFlags(rootCmd, rootArgs, login.Cmd(rootArgs, shared.Printf))
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(-1)
+	err := rootCmd.Execute()
+	if terr := rootArgs.WriteTrace(); terr != nil {
+		shared.Errorf("%v", terr)
+	}
+	if err != nil {
+		if hint := rootArgs.ErrorHint(err); hint != "" {
+			shared.Errorf("hint: %s", hint)
+		}
+		stop()
+		os.Exit(shared.ExitCode(err))
 	}
 }
@@ -0,0 +1,37 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+// App is the developer app that holds the remote-service credentials
+type App struct {
+	Name        string          `json:"name,omitempty"`
+	APIProducts []string        `json:"apiProducts,omitempty"`
+	Credentials []AppCredential `json:"credentials,omitempty"`
+}
+
+// AppCredential is a key and secret of an App
+type AppCredential struct {
+	Key         string              `json:"consumerKey,omitempty"`
+	Secret      string              `json:"consumerSecret,omitempty"`
+	Status      string              `json:"status,omitempty"`
+	IssuedAt    string              `json:"issuedAt,omitempty"`
+	APIProducts []CredentialProduct `json:"apiProducts,omitempty"`
+}
+
+// CredentialProduct is the approval of a product for an AppCredential
+type CredentialProduct struct {
+	Name   string `json:"apiproduct"`
+	Status string `json:"status"`
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formats for emitting Kubernetes resources
+const (
+	EmitHelm      = "helm"      // Helm values.yaml fragment
+	EmitKustomize = "kustomize" // Kustomize base written to a directory
+
+	helmValuesKey = "apigeeRemoteServiceEnvoy"
+)
+
+type helmValues struct {
+	ConfigMaps []helmResource `yaml:"configMaps,omitempty"`
+	Secrets    []helmResource `yaml:"secrets,omitempty"`
+}
+
+type helmResource struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+	Type      string            `yaml:"type,omitempty"`
+	Data      map[string]string `yaml:"data"`
+}
+
+// PrintHelmValues prints the ConfigMaps and Secrets of resources as a Helm
+// values.yaml fragment, generated by command
+func PrintHelmValues(resources []KubernetesCRD, command string, printf FormatFn) error {
+	var values helmValues
+	for _, r := range resources {
+		hr := helmResource{
+			Name:      r.Metadata.Name,
+			Namespace: r.Metadata.Namespace,
+			Labels:    r.Metadata.Labels,
+			Type:      r.Type,
+			Data:      r.Data,
+		}
+		switch r.Kind {
+		case "ConfigMap":
+			values.ConfigMaps = append(values.ConfigMaps, hr)
+		case "Secret":
+			values.Secrets = append(values.Secrets, hr)
+		default:
+			return fmt.Errorf("%s %s can't be emitted as Helm values", r.Kind, r.Metadata.Name)
+		}
+	}
+
+	var yamlBuffer bytes.Buffer
+	yamlEncoder := yaml.NewEncoder(&yamlBuffer)
+	yamlEncoder.SetIndent(2)
+	if err := yamlEncoder.Encode(map[string]helmValues{helmValuesKey: values}); err != nil {
+		return err
+	}
+
+	printf("# Helm values for apigee-remote-service-envoy")
+	printf("# generated by apigee-remote-service-cli %s on %s", command, time.Now().Format("2006-01-02 15:04:05"))
+	printf("%s", yamlBuffer.String())
+	return nil
+}
+
+// KustomizeFileName returns the name of the file for a resource in a
+// Kustomize base
+func KustomizeFileName(kind, name string) string {
+	return fmt.Sprintf("%s-%s.yaml", name, strings.ToLower(kind))
+}
+
+// WriteKustomizeBase writes files, a map of file name to content, to dir
+// along with a kustomization.yaml that lists them as resources. As resources
+// may include secrets, the files are readable only by the user.
+func WriteKustomizeBase(dir string, files map[string]string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := WriteFile(filepath.Join(dir, name), files[name]); err != nil {
+			return err
+		}
+	}
+
+	kustomization := struct {
+		APIVersion string   `yaml:"apiVersion"`
+		Kind       string   `yaml:"kind"`
+		Resources  []string `yaml:"resources"`
+	}{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Resources:  names,
+	}
+	var yamlBuffer bytes.Buffer
+	yamlEncoder := yaml.NewEncoder(&yamlBuffer)
+	yamlEncoder.SetIndent(2)
+	if err := yamlEncoder.Encode(kustomization); err != nil {
+		return err
+	}
+	return WriteFile(filepath.Join(dir, "kustomization.yaml"), yamlBuffer.String())
+}
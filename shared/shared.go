@@ -15,14 +15,19 @@
 package shared
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
+	"os/signal"
 	"reflect"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/apigee/apigee-remote-service-cli/apigee"
 	"github.com/apigee/apigee-remote-service-cli/testutil"
@@ -51,6 +56,12 @@ const (
 	internalProxyURLFormatOPDK  = "%s/edgemicro"                    // runtimeBase
 	remoteServicePath           = "/remote-service"
 	remoteServiceProxyURLFormat = "%s" + remoteServicePath // runtimeBase
+
+	// DefaultTimeout is the default time limit for each management API request
+	DefaultTimeout = 2 * time.Minute
+
+	// DefaultRetries is the default number of retries for transient management API failures
+	DefaultRetries = 3
 )
 
 // BuildInfoType holds version information
@@ -68,17 +79,27 @@ type RootArgs struct {
 	RuntimeBase        string // "https://org-env.apigee.net"
 	ManagementBase     string // "https://api.enterprise.apigee.com"
 	Verbose            bool
+	UnsafeDebug        bool
 	Org                string
 	Env                string
 	Username           string
 	Password           string
 	Token              string
+	ServiceAccount     string
+	UseADC             bool
+	AuthMethod         string
+	AuthCommand        string
+	AuthFile           string
 	NetrcPath          string
 	IsOPDK             bool
 	IsLegacySaaS       bool
 	IsGCPManaged       bool
 	ConfigPath         string
 	InsecureSkipVerify bool
+	Timeout            time.Duration
+	Retries            int
+	RetryBackoff       time.Duration
+	TraceFile          string
 
 	ServerConfig *server.Config // config loaded from ConfigPath
 
@@ -87,6 +108,9 @@ type RootArgs struct {
 	RemoteServiceProxyURL string
 	Client                *apigee.EdgeClient
 	ClientOpts            *apigee.EdgeClientOptions
+
+	ctx    context.Context
+	tracer *apigee.Tracer
 }
 
 // AddCommandWithFlags adds to the root command with standard flags
@@ -97,6 +121,8 @@ func AddCommandWithFlags(c *cobra.Command, rootArgs *RootArgs, cmds ...*cobra.Co
 
 		subC.PersistentFlags().BoolVarP(&rootArgs.Verbose, "verbose", "v",
 			false, "verbose output")
+		subC.PersistentFlags().BoolVarP(&rootArgs.UnsafeDebug, "unsafe-debug", "",
+			false, "with --verbose, show credentials and secrets in HTTP output")
 
 		subC.PersistentFlags().StringVarP(&rootArgs.Org, "organization", "o",
 			"", "Apigee organization name")
@@ -109,6 +135,25 @@ func AddCommandWithFlags(c *cobra.Command, rootArgs *RootArgs, cmds ...*cobra.Co
 		subC.PersistentFlags().BoolVarP(&rootArgs.InsecureSkipVerify, "insecure", "",
 			false, "Allow insecure server connections when using SSL")
 
+		subC.PersistentFlags().StringVarP(&rootArgs.AuthMethod, "auth", "", "",
+			fmt.Sprintf("Credential provider: %s (default: inferred from other flags)",
+				strings.Join(apigee.AuthMethods(), ", ")))
+		subC.PersistentFlags().StringVarP(&rootArgs.AuthCommand, "auth-command", "", "",
+			"Command that prints an Apigee OAuth token")
+		subC.PersistentFlags().StringVarP(&rootArgs.AuthFile, "auth-file", "", "",
+			"File containing an Apigee OAuth token, read for each request")
+
+		subC.PersistentFlags().DurationVarP(&rootArgs.Timeout, "timeout", "",
+			DefaultTimeout, "Time limit for each management API request, except proxy imports and deployments (0 for none)")
+
+		subC.PersistentFlags().IntVarP(&rootArgs.Retries, "retries", "",
+			DefaultRetries, "Number of retries for transient management API failures (0 for none)")
+		subC.PersistentFlags().DurationVarP(&rootArgs.RetryBackoff, "retry-backoff", "",
+			apigee.DefaultMinBackoff, "Delay before the first retry, doubled for each retry")
+
+		subC.PersistentFlags().StringVarP(&rootArgs.TraceFile, "trace-file", "", "",
+			"Record management API requests and responses to this HAR file")
+
 		c.AddCommand(subC)
 	}
 }
@@ -166,8 +211,8 @@ func (r *RootArgs) Resolve(skipAuth, requireRuntime bool) error {
 
 	r.RemoteServiceProxyURL = fmt.Sprintf(remoteServiceProxyURLFormat, r.RuntimeBase)
 
-	if r.IsGCPManaged && !skipAuth && r.Token == "" {
-		return fmt.Errorf("--token is required for hybrid")
+	if r.IsGCPManaged && !skipAuth && !r.hasGCPAuth() {
+		return fmt.Errorf("--token, --service-account, --adc, or --auth is required for hybrid")
 	}
 
 	r.ClientOpts = &apigee.EdgeClientOptions{
@@ -175,14 +220,33 @@ func (r *RootArgs) Resolve(skipAuth, requireRuntime bool) error {
 		Org:     r.Org,
 		Env:     r.Env,
 		Auth: &apigee.EdgeAuth{
-			NetrcPath:   r.NetrcPath,
-			Username:    r.Username,
-			Password:    r.Password,
-			BearerToken: r.Token,
-			SkipAuth:    skipAuth,
+			NetrcPath:             r.NetrcPath,
+			Username:              r.Username,
+			Password:              r.Password,
+			BearerToken:           r.Token,
+			GoogleCredentialsPath: r.ServiceAccount,
+			UseADC:                r.UseADC,
+			Command:               r.AuthCommand,
+			File:                  r.AuthFile,
+			Method:                r.AuthMethod,
+			SkipAuth:              skipAuth,
 		},
-		GCPManaged: r.IsGCPManaged,
-		Debug:      r.Verbose,
+		GCPManaged:  r.IsGCPManaged,
+		Debug:       r.Verbose,
+		UnsafeDebug: r.UnsafeDebug,
+		Timeout:     r.Timeout,
+		Retry: apigee.RetryPolicy{
+			MaxRetries: r.Retries,
+			MinBackoff: r.RetryBackoff,
+		},
+	}
+
+	if r.TraceFile != "" {
+		if r.tracer == nil { // Resolve may be called again, keep one trace
+			r.tracer = apigee.NewTracer("apigee-remote-service-cli", BuildInfo.Version)
+			r.tracer.Unsafe = r.UnsafeDebug
+		}
+		r.ClientOpts.Tracer = r.tracer
 	}
 
 	var err error
@@ -193,7 +257,7 @@ func (r *RootArgs) Resolve(skipAuth, requireRuntime bool) error {
 			if err != nil {
 				return fmt.Errorf("unable to parse managementBase url %s: %v", r.ManagementBase, err)
 			}
-			return fmt.Errorf("no auth: must have username and password or a ~/.netrc entry for %s", baseURL.Host)
+			return fmt.Errorf("no auth: must have username and password, a ~/.netrc entry for %s, or a cached login", baseURL.Host)
 		}
 		return fmt.Errorf("error initializing Edge client: %v", err)
 	}
@@ -201,6 +265,107 @@ func (r *RootArgs) Resolve(skipAuth, requireRuntime bool) error {
 	return nil
 }
 
+// hasGCPAuth returns true if a credential source usable for hybrid is specified
+func (r *RootArgs) hasGCPAuth() bool {
+	return r.Token != "" || r.ServiceAccount != "" || r.UseADC ||
+		r.AuthMethod != "" || r.AuthCommand != "" || r.AuthFile != ""
+}
+
+// WriteTrace writes the requests recorded for --trace-file, if any. Call it
+// after the command completes, whether or not it succeeded.
+func (r *RootArgs) WriteTrace() error {
+	if r.tracer == nil {
+		return nil
+	}
+	if err := r.tracer.WriteHARFile(r.TraceFile); err != nil {
+		return fmt.Errorf("writing trace file %s: %v", r.TraceFile, err)
+	}
+	return nil
+}
+
+// ErrorHint returns a suggestion for resolving a management API error, or
+// empty if there is none
+func (r *RootArgs) ErrorHint(err error) string {
+	switch {
+	case errors.Is(err, apigee.ErrUnauthorized):
+		switch {
+		case r.IsGCPManaged:
+			return "the token may have expired: run `gcloud auth print-access-token` for a new --token, or use --service-account or --adc"
+		case r.IsLegacySaaS:
+			return "check your username and password, or run the login command again if your cached login has expired"
+		default:
+			return "check your username and password or ~/.netrc entry"
+		}
+	case errors.Is(err, apigee.ErrForbidden):
+		return fmt.Sprintf("the credentials are valid but lack permission for organization %s: check the account's roles", r.Org)
+	case errors.Is(err, apigee.ErrNotFound):
+		return fmt.Sprintf("check that organization %s and environment %s exist and that remote service is provisioned", r.Org, r.Env)
+	case errors.Is(err, apigee.ErrConflict):
+		return "the resource already exists: use a different name or remove the existing resource"
+	case errors.Is(err, apigee.ErrRateLimited):
+		return "the management API is limiting requests: wait and try again, or increase --retries and --retry-backoff"
+	}
+	return ""
+}
+
+// ExitError is returned by a command that should exit with Code rather than
+// the usual -1, such as one whose failure is only partial
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the process exit code for an error returned by a command
+func ExitCode(err error) int {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return -1
+}
+
+// Context returns the Context for management API requests. It is cancelled
+// on interrupt if set by SetContext, otherwise it is never cancelled.
+func (r *RootArgs) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// SetContext sets the Context for management API requests
+func (r *RootArgs) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// InterruptContext returns a Context that is cancelled on the first SIGINT or
+// SIGTERM. Later signals are handled as usual so a second Ctrl-C exits
+// immediately. Call stop to release resources.
+func InterruptContext(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			Errorf("interrupted, cancelling requests...")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
+
 // FormatFn formats the supplied arguments according to the format string
 // provided and executes some set of operations with the result.
 type FormatFn func(format string, args ...interface{})
@@ -219,6 +384,43 @@ func Errorf(format string, args ...interface{}) {
 func NoPrintf(format string, args ...interface{}) {
 }
 
+// WriterFormatFn bridges FormatFn to io.Writer, writing lines as Printf does
+func WriterFormatFn(w io.Writer) FormatFn {
+	return func(format string, args ...interface{}) {
+		fmt.Fprintf(w, format+"\n", args...)
+	}
+}
+
+// WriteFile writes content to path, creating or truncating it. As generated
+// files may include credentials and private keys, the file is made readable
+// only by the user.
+func WriteFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Confirm prompts for a yes or no answer on in, defaulting to no
+func Confirm(in io.Reader, printf FormatFn) bool {
+	printf("continue? [y/N]")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 // FormatFnWriter bridges io.Writer to FormatFn
 func FormatFnWriter(fn FormatFn) io.Writer {
 	return &formatFnWriter{fn}
@@ -328,6 +530,7 @@ type KubernetesCRD struct {
 
 // Metadata is for Kubernetes CRD generation
 type Metadata struct {
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace"`
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
 }
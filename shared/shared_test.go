@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/apigee/apigee-remote-service-cli/apigee"
+)
+
+func TestErrorHint(t *testing.T) {
+	errorResponse := func(status int) error {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.enterprise.apigee.com/v1/organizations/org", nil)
+		return &apigee.ErrorResponse{Response: &http.Response{StatusCode: status, Request: req}}
+	}
+
+	opdk := RootArgs{Org: "/org/", Env: "/env/", IsOPDK: true}
+	legacy := RootArgs{Org: "/org/", Env: "/env/", IsLegacySaaS: true}
+	hybrid := RootArgs{Org: "/org/", Env: "/env/", IsGCPManaged: true}
+
+	tests := []struct {
+		args RootArgs
+		err  error
+		want string
+	}{
+		{opdk, errorResponse(http.StatusUnauthorized), "~/.netrc"},
+		{legacy, errorResponse(http.StatusUnauthorized), "login command"},
+		{hybrid, errorResponse(http.StatusUnauthorized), "--service-account"},
+		{opdk, errorResponse(http.StatusForbidden), "organization /org/"},
+		{opdk, errorResponse(http.StatusNotFound), "environment /env/"},
+		{opdk, errorResponse(http.StatusConflict), "already exists"},
+		{opdk, errorResponse(http.StatusTooManyRequests), "--retries"},
+		{opdk, errorResponse(http.StatusInternalServerError), ""},
+		{opdk, errors.New("connection refused"), ""},
+	}
+	for _, test := range tests {
+		hint := test.args.ErrorHint(test.err)
+		if test.want == "" && hint != "" || !strings.Contains(hint, test.want) {
+			t.Errorf("%v want hint containing %q, got: %q", test.err, test.want, hint)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	exitErr := &ExitError{Code: 1, Err: errors.New("partial failure")}
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("failure"), -1},
+		{exitErr, 1},
+		{fmt.Errorf("wrapped: %w", exitErr), 1},
+	}
+	for _, test := range tests {
+		if got := ExitCode(test.err); got != test.want {
+			t.Errorf("%v want exit code %d, got: %d", test.err, test.want, got)
+		}
+	}
+	if exitErr.Error() != "partial failure" {
+		t.Errorf("want the underlying error message, got: %s", exitErr.Error())
+	}
+}